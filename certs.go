@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The key types that `otero certs` can generate.
+const (
+	keyTypeRSA     = "rsa"
+	keyTypeECDSA   = "ecdsa"
+	keyTypeEd25519 = "ed25519"
+)
+
+// certSpec describes a certificate that is to be generated.
+type certSpec struct {
+	name    string // the files are named <name>.crt & <name>.key
+	subject string // openssl style, eg; /C=US/O=MyOrg/CN=myOrgCA
+	sans    string // comma separated DNS names, IP addresses & URIs(eg, a SPIFFE ID).
+	keyType string
+	days    int
+	// keyPerm is the file mode of the private key.
+	keyPerm os.FileMode
+	// usage is the extended key usage of the certificate; it is nil for the CA.
+	usage []x509.ExtKeyUsage
+}
+
+// runCerts implements the `otero certs` subcommand.
+// It generates the root CA, plus the certificates signed by it, that are used for mTLS between
+// the services, the otel collector & jaeger. It replaces certs.sh, so that no openssl is needed.
+//
+// The server certificate is used by the otel collector & jaeger, the client certificate by the exporters of the services,
+// and the service_a & service_b certificates for mTLS between the services themselves; see serviceTLS.
+//
+// usage:
+//
+//	go run . certs -dir confs/tls -key-type ecdsa
+func runCerts(args []string, out io.Writer) error {
+	ca := certSpec{
+		name:    "rootCA",
+		subject: "/C=US/ST=CA/O=MyOrg/CN=myOrgCA",
+		days:    1024,
+		// The CA key is never read by the containers.
+		keyPerm: 0o600,
+	}
+	server := certSpec{
+		name:    "server",
+		subject: "/C=US/ST=CA/O=MyOrg/CN=otel_collector",
+		sans:    "otel_collector,jaeger,prometheus,localhost,127.0.0.1",
+		days:    372,
+		// The otel collector & jaeger containers run as a different user than the one that generates the key.
+		keyPerm: 0o644,
+		// The otel collector also presents the server certificate, as a client certificate, when it exports to jaeger.
+		usage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	client := certSpec{
+		name:    "client",
+		subject: "/C=US/ST=CA/O=MyOrg/CN=otero",
+		// The client certificate needs a SAN for the otel collector; see telemetry.TLSConfig
+		sans:    "otel_collector,localhost,127.0.0.1",
+		days:    372,
+		keyPerm: 0o600,
+		usage:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	// Each service presents its certificate both as a server & as a client.
+	// Its SPIFFE ID identifies it to its peers; see peerAttributes.
+	serviceA := certSpec{
+		name:    "service_a",
+		subject: "/C=US/ST=CA/O=MyOrg/CN=otero_service_a",
+		sans:    "otero_service_a,localhost,127.0.0.1,spiffe://otero/service/a",
+		days:    372,
+		keyPerm: 0o600,
+		usage:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	serviceB := certSpec{
+		name:    "service_b",
+		subject: "/C=US/ST=CA/O=MyOrg/CN=otero_service_b",
+		sans:    "otero_service_b,localhost,127.0.0.1,spiffe://otero/service/b",
+		days:    372,
+		keyPerm: 0o600,
+		usage:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	fs := flag.NewFlagSet("certs", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dir := fs.String("dir", "./confs/tls", "directory that the certificates & keys are written to.")
+	fileExporter := fs.String("file-exporter", "./confs/otel_file_exporter.json", "file that the otel collector's file exporter writes to; it is created, and made writable, if it does not exist. Empty disables it.")
+	keyType := fs.String("key-type", keyTypeECDSA, "key type of all certificates, unless overridden per certificate; rsa, ecdsa(P-256) or ed25519.")
+	rsaBits := fs.Int("rsa-bits", 3072, "size of rsa keys.")
+	specs := map[string]*certSpec{"ca": &ca, "server": &server, "client": &client, "service-a": &serviceA, "service-b": &serviceB}
+	for p, s := range specs {
+		fs.StringVar(&s.subject, p+"-subject", s.subject, fmt.Sprintf("subject of the %s certificate.", p))
+		fs.StringVar(&s.keyType, p+"-key-type", "", fmt.Sprintf("key type of the %s certificate; defaults to -key-type.", p))
+		fs.IntVar(&s.days, p+"-days", s.days, fmt.Sprintf("number of days that the %s certificate is valid for.", p))
+		if s != &ca {
+			fs.StringVar(&s.sans, p+"-sans", s.sans, fmt.Sprintf("comma separated DNS names, IP addresses & URIs of the %s certificate.", p))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	for _, s := range specs {
+		if s.keyType == "" {
+			s.keyType = *keyType
+		}
+		if s.days <= 0 {
+			return fmt.Errorf("certs: the %s certificate has an invalid validity of %d days", s.name, s.days)
+		}
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+
+	caCert, caKey, err := generateCert(ca, nil, nil, *rsaBits)
+	if err != nil {
+		return err
+	}
+	if err := writeCert(*dir, ca, caCert, caKey, out); err != nil {
+		return err
+	}
+	for _, s := range []certSpec{server, client, serviceA, serviceB} {
+		cert, key, err := generateCert(s, caCert, caKey, *rsaBits)
+		if err != nil {
+			return err
+		}
+		if err := writeCert(*dir, s, cert, key, out); err != nil {
+			return err
+		}
+	}
+
+	if *fileExporter != "" {
+		// The otel collector image has no writable file-system, so it writes to this file which is mounted into it.
+		if err := writeFile(*fileExporter, nil, 0o666, false); err != nil {
+			return fmt.Errorf("certs: %w", err)
+		}
+		fmt.Fprintf(out, "created %s\n", *fileExporter)
+	}
+
+	return nil
+}
+
+// generateCert generates a certificate for s, signed by parent.
+// If parent is nil, the certificate is a self-signed CA.
+func generateCert(s certSpec, parent *x509.Certificate, parentKey crypto.Signer, rsaBits int) (*x509.Certificate, crypto.Signer, error) {
+	key, err := generateKey(s.keyType, rsaBits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("certs: %s: %w", s.name, err)
+	}
+	subject, err := parseSubject(s.subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("certs: %s: %w", s.name, err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("certs: %s: %w", s.name, err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		// Allow for clock skew between the machines.
+		NotBefore:   now.Add(-5 * time.Minute),
+		NotAfter:    now.AddDate(0, 0, s.days),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: s.usage,
+	}
+	if s.keyType == keyTypeRSA {
+		// RSA key exchange, as used by some TLS 1.2 cipher suites, encrypts with the key of the certificate.
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, san := range strings.Split(s.sans, ",") {
+		san = strings.TrimSpace(san)
+		if san == "" {
+			continue
+		}
+		if ip := net.ParseIP(san); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if strings.Contains(san, "://") {
+			u, err := url.Parse(san)
+			if err != nil {
+				return nil, nil, fmt.Errorf("certs: %s: invalid SAN: %w", s.name, err)
+			}
+			tmpl.URIs = append(tmpl.URIs, u)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, san)
+		}
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		// The CA only signs leaf certificates.
+		tmpl.MaxPathLenZero = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("certs: %s: %w", s.name, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("certs: %s: %w", s.name, err)
+	}
+	return cert, key, nil
+}
+
+func generateKey(keyType string, rsaBits int) (crypto.Signer, error) {
+	switch keyType {
+	case keyTypeRSA:
+		if rsaBits < 2048 {
+			return nil, fmt.Errorf("rsa keys need at least 2048 bits, got %d", rsaBits)
+		}
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	case keyTypeECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case keyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("invalid key type %q; valid ones are %s, %s & %s", keyType, keyTypeRSA, keyTypeECDSA, keyTypeEd25519)
+	}
+}
+
+// parseSubject parses an openssl style subject, eg; /C=US/ST=CA/O=MyOrg/CN=myOrgCA
+func parseSubject(s string) (pkix.Name, error) {
+	var n pkix.Name
+	for _, part := range strings.Split(strings.TrimPrefix(s, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		if !ok || v == "" {
+			return n, fmt.Errorf("invalid subject %q; it should be of the form /C=US/O=MyOrg/CN=name", s)
+		}
+		switch strings.ToUpper(strings.TrimSpace(k)) {
+		case "C":
+			n.Country = append(n.Country, v)
+		case "ST":
+			n.Province = append(n.Province, v)
+		case "L":
+			n.Locality = append(n.Locality, v)
+		case "O":
+			n.Organization = append(n.Organization, v)
+		case "OU":
+			n.OrganizationalUnit = append(n.OrganizationalUnit, v)
+		case "CN":
+			n.CommonName = v
+		default:
+			return n, fmt.Errorf("invalid subject %q; unknown attribute %q, valid ones are C, ST, L, O, OU & CN", s, k)
+		}
+	}
+	if n.CommonName == "" {
+		return n, fmt.Errorf("invalid subject %q; CN is required", s)
+	}
+	return n, nil
+}
+
+// writeCert writes the certificate & key of s to <dir>/<name>.crt & <dir>/<name>.key
+func writeCert(dir string, s certSpec, cert *x509.Certificate, key crypto.Signer, out io.Writer) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("certs: %s: %w", s.name, err)
+	}
+
+	certFile := filepath.Join(dir, s.name+".crt")
+	keyFile := filepath.Join(dir, s.name+".key")
+	if err := writeFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o644, true); err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+	if err := writeFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), s.keyPerm, true); err != nil {
+		return fmt.Errorf("certs: %w", err)
+	}
+
+	fmt.Fprintf(out, "created %s & %s; subject=%s, key=%s, expires=%s\n",
+		certFile, keyFile, cert.Subject, s.keyType, cert.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+// writeFile writes data to path, and sets its mode to perm regardless of the umask.
+// If truncate is false, an existing file is left as is; only its mode is set.
+func writeFile(path string, data []byte, perm os.FileMode, truncate bool) error {
+	flags := os.O_WRONLY | os.O_CREATE
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return err
+	}
+	_, wErr := f.Write(data)
+	return errors.Join(wErr, f.Chmod(perm), f.Close())
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSubject(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    pkix.Name
+		wantErr bool
+	}{
+		{in: "/CN=otero", want: pkix.Name{CommonName: "otero"}},
+		{in: "CN=otero", want: pkix.Name{CommonName: "otero"}},
+		{
+			in: "/C=US/ST=CA/L=SF/O=MyOrg/OU=a/OU=b/CN=myOrgCA",
+			want: pkix.Name{
+				Country: []string{"US"}, Province: []string{"CA"}, Locality: []string{"SF"},
+				Organization: []string{"MyOrg"}, OrganizationalUnit: []string{"a", "b"}, CommonName: "myOrgCA",
+			},
+		},
+		{in: "/o=MyOrg//cn=x", want: pkix.Name{Organization: []string{"MyOrg"}, CommonName: "x"}},
+		{in: "", wantErr: true},
+		{in: "/O=MyOrg", wantErr: true},
+		{in: "/CN", wantErr: true},
+		{in: "/CN=", wantErr: true},
+		{in: "/X=y/CN=otero", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSubject(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSubject(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSubject(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	if k, err := generateKey(keyTypeECDSA, 0); err != nil || reflect.TypeOf(k) != reflect.TypeOf(&ecdsa.PrivateKey{}) {
+		t.Errorf("generateKey(ecdsa) = %T, %v", k, err)
+	}
+	if k, err := generateKey(keyTypeEd25519, 0); err != nil || reflect.TypeOf(k) != reflect.TypeOf(ed25519.PrivateKey{}) {
+		t.Errorf("generateKey(ed25519) = %T, %v", k, err)
+	}
+	if k, err := generateKey(keyTypeRSA, 2048); err != nil || reflect.TypeOf(k) != reflect.TypeOf(&rsa.PrivateKey{}) {
+		t.Errorf("generateKey(rsa) = %T, %v", k, err)
+	}
+	if _, err := generateKey(keyTypeRSA, 1024); err == nil {
+		t.Error("generateKey(rsa, 1024) expected an error")
+	}
+	if _, err := generateKey("dsa", 0); err == nil {
+		t.Error("generateKey(dsa) expected an error")
+	}
+}
+
+func TestGenerateCert(t *testing.T) {
+	ca, caKey, err := generateCert(certSpec{name: "ca", subject: "/CN=ca", keyType: keyTypeECDSA, days: 10}, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("generateCert(ca) error = %v", err)
+	}
+	if !ca.IsCA || !ca.MaxPathLenZero || ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Errorf("CA certificate: IsCA = %v, MaxPathLenZero = %v, KeyUsage = %v", ca.IsCA, ca.MaxPathLenZero, ca.KeyUsage)
+	}
+
+	s := certSpec{
+		name:    "svc",
+		subject: "/O=MyOrg/CN=svc",
+		sans:    " svc, localhost,127.0.0.1,::1,spiffe://otero/service/a,",
+		keyType: keyTypeRSA,
+		days:    3,
+		usage:   []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, _, err := generateCert(s, ca, caKey, 2048)
+	if err != nil {
+		t.Fatalf("generateCert() error = %v", err)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"svc", "localhost"}) {
+		t.Errorf("DNSNames = %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 2 || cert.IPAddresses[0].String() != "127.0.0.1" || cert.IPAddresses[1].String() != "::1" {
+		t.Errorf("IPAddresses = %v", cert.IPAddresses)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://otero/service/a" {
+		t.Errorf("URIs = %v", cert.URIs)
+	}
+	if cert.IsCA || cert.KeyUsage&x509.KeyUsageKeyEncipherment == 0 {
+		t.Errorf("leaf certificate: IsCA = %v, KeyUsage = %v; want key encipherment for rsa", cert.IsCA, cert.KeyUsage)
+	}
+	if d := cert.NotAfter.Sub(time.Now().AddDate(0, 0, 3)); d > time.Minute || d < -time.Minute {
+		t.Errorf("NotAfter = %v, want 3 days from now", cert.NotAfter)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "svc", KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	s.subject = "/O=MyOrg"
+	if _, _, err := generateCert(s, ca, caKey, 2048); err == nil {
+		t.Error("generateCert() with no CN; expected an error")
+	}
+}
+
+func TestRunCerts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	exporter := filepath.Join(t.TempDir(), "otel_file_exporter.json")
+	var out bytes.Buffer
+	err := runCerts([]string{"-dir", dir, "-file-exporter", exporter, "-key-type", "ed25519", "-client-days", "30", "-server-sans", "collector"}, &out)
+	if err != nil {
+		t.Fatalf("runCerts() error = %v; %s", err, out.String())
+	}
+
+	roots := x509.NewCertPool()
+	caCert := loadCert(t, filepath.Join(dir, "rootCA.crt"), filepath.Join(dir, "rootCA.key"))
+	roots.AddCert(caCert.Leaf)
+
+	tests := []struct {
+		name    string
+		usage   x509.ExtKeyUsage
+		san     string
+		keyPerm os.FileMode
+		days    int
+	}{
+		{"server", x509.ExtKeyUsageServerAuth, "collector", 0o644, 372},
+		{"client", x509.ExtKeyUsageClientAuth, "otel_collector", 0o600, 30},
+		{"service_a", x509.ExtKeyUsageServerAuth, "otero_service_a", 0o600, 372},
+		{"service_b", x509.ExtKeyUsageClientAuth, "otero_service_b", 0o600, 372},
+	}
+	for _, tt := range tests {
+		keyFile := filepath.Join(dir, tt.name+".key")
+		c := loadCert(t, filepath.Join(dir, tt.name+".crt"), keyFile)
+		if _, ok := c.PrivateKey.(ed25519.PrivateKey); !ok {
+			t.Errorf("%s: key is a %T, want ed25519", tt.name, c.PrivateKey)
+		}
+		if _, err := c.Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: tt.san, KeyUsages: []x509.ExtKeyUsage{tt.usage}}); err != nil {
+			t.Errorf("%s: Verify() error = %v", tt.name, err)
+		}
+		if days := int(time.Until(c.Leaf.NotAfter).Hours()/24 + 0.5); days != tt.days {
+			t.Errorf("%s: valid for %d days, want %d", tt.name, days, tt.days)
+		}
+		if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != tt.keyPerm {
+			t.Errorf("%s: key file mode = %v, %v; want %v", tt.name, fi.Mode().Perm(), err, tt.keyPerm)
+		}
+	}
+	if fi, err := os.Stat(exporter); err != nil || fi.Mode().Perm() != 0o666 {
+		t.Errorf("file exporter file = %v, %v; want it to be writable by all", fi, err)
+	}
+	if !strings.Contains(out.String(), "created "+exporter) {
+		t.Errorf("output = %s", out.String())
+	}
+
+	for _, args := range [][]string{{"-ca-days", "0"}, {"-key-type", "dsa"}, {"-client-subject", "/O=x"}, {"-unknown"}} {
+		out.Reset()
+		if err := runCerts(append([]string{"-dir", dir, "-file-exporter", ""}, args...), &out); err == nil {
+			t.Errorf("runCerts(%v) expected an error", args)
+		}
+	}
+	if err := runCerts([]string{"-h"}, &out); err != nil {
+		t.Errorf("runCerts(-h) error = %v", err)
+	}
+}
+
+func loadCert(t *testing.T, certFile, keyFile string) tls.Certificate {
+	t.Helper()
+
+	c, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair() error = %v", err)
+	}
+	c.Leaf, err = x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return c
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// debugHeader is the request header that forces a request to be debugged;
+	// its trace is sampled & its logs are made at debug level.
+	debugHeader = "X-Debug-Trace"
+	// debugBaggageKey is the baggage member that carries a signed token to downstream services.
+	debugBaggageKey = "debug.trace"
+	// debugPropagationTTL is the most that a token propagated to downstream services is valid for.
+	// Baggage is sent on every outbound request, including to third parties; so it should not carry long-lived credentials.
+	debugPropagationTTL = time.Minute
+)
+
+// debugVerifier decides whether the token of a debugHeader is to be trusted.
+// A token is trusted if it is one of tokens, or if it is signed with secret.
+//
+// A signed token is of the form `<expiry>.<signature>`; where expiry is a unix timestamp
+// and signature is the hex encoded HMAC-SHA256 of expiry, using secret as the key.
+// Signed tokens that expire more than maxTTL from now are not trusted, so that they can not be used as permanent tokens.
+type debugVerifier struct {
+	tokens []string
+	secret []byte
+	maxTTL time.Duration
+}
+
+// verify reports whether token is trusted at now, and when it expires.
+// The expiry of the static tokens is the zero time; they do not expire.
+func (v debugVerifier) verify(token string, now time.Time) (time.Time, bool) {
+	if token == "" {
+		return time.Time{}, false
+	}
+
+	for _, t := range v.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return time.Time{}, true
+		}
+	}
+
+	if len(v.secret) == 0 {
+		return time.Time{}, false
+	}
+	expiry, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, v.signature(expiry)) {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	exp := time.Unix(unix, 0)
+	if now.After(exp) || exp.Sub(now) > v.maxTTL {
+		return time.Time{}, false
+	}
+	return exp, true
+}
+
+// sign returns a token that is signed with secret, and expires at exp.
+func (v debugVerifier) sign(exp time.Time) string {
+	expiry := strconv.FormatInt(exp.Unix(), 10)
+	return expiry + "." + hex.EncodeToString(v.signature(expiry))
+}
+
+func (v debugVerifier) signature(expiry string) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(expiry))
+	return mac.Sum(nil)
+}
+
+type debugCtxKey struct{}
+
+// isDebug reports whether ctx belongs to a request that is being debugged; see debugHandler.
+func isDebug(ctx context.Context) bool {
+	ok, _ := ctx.Value(debugCtxKey{}).(bool)
+	return ok
+}
+
+// debugHandler returns a http.Handler that debugs requests which have a trusted debugHeader, or baggage from an upstream service that was debugged.
+// For such requests it;
+// (a) forces the trace to be sampled; see debugSampler.
+// (b) makes logs at debug level, for that request only.
+// (c) propagates a signed token downstream, via baggage, that expires within debugPropagationTTL.
+// The token of the request itself is never propagated; without a secret, nothing is.
+//
+// It should wrap the otelhttp handler, so that the sampling decision is made before the server span is started.
+func debugHandler(h http.Handler, v debugVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		carrier := propagation.HeaderCarrier(r.Header)
+		bag := baggage.FromContext(propagation.Baggage{}.Extract(r.Context(), carrier))
+
+		token := r.Header.Get(debugHeader)
+		if token == "" {
+			token, _ = url.PathUnescape(bag.Member(debugBaggageKey).Value())
+		}
+		now := time.Now()
+		exp, ok := v.verify(token, now)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), debugCtxKey{}, true)
+		ctx = log.ContextWithLevel(ctx, log.DebugLevel)
+
+		propagated := now.Add(debugPropagationTTL)
+		if !exp.IsZero() && exp.Before(propagated) {
+			propagated = exp
+		}
+		b := bag.DeleteMember(debugBaggageKey)
+		if len(v.secret) > 0 {
+			if m, err := baggage.NewMember(debugBaggageKey, v.sign(propagated)); err == nil {
+				b, _ = b.SetMember(m)
+			}
+		}
+		// The otelhttp handler extracts baggage from the request headers, so it is set there.
+		r.Header.Del("baggage")
+		propagation.Baggage{}.Inject(baggage.ContextWithBaggage(ctx, b), carrier)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// debugSampler samples all the spans of requests that are being debugged, and defers to next for all others.
+type debugSampler struct {
+	next trace.Sampler
+}
+
+func (d debugSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	if isDebug(p.ParentContext) {
+		return trace.AlwaysSample().ShouldSample(p)
+	}
+	return d.next.ShouldSample(p)
+}
+
+func (d debugSampler) Description() string {
+	return "DebugSampler{" + d.next.Description() + "}"
+}
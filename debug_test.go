@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestDebugVerifier(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := debugVerifier{tokens: []string{"static"}, secret: []byte("secret"), maxTTL: time.Hour}
+	other := debugVerifier{secret: []byte("other"), maxTTL: time.Hour}
+	valid := v.sign(now.Add(10 * time.Minute))
+	expiry, _, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name    string
+		v       debugVerifier
+		token   string
+		wantOk  bool
+		wantExp time.Time
+	}{
+		{"empty", v, "", false, time.Time{}},
+		{"static", v, "static", true, time.Time{}},
+		{"unknown static", v, "statix", false, time.Time{}},
+		{"signed", v, valid, true, now.Add(10 * time.Minute)},
+		{"signed without a secret", debugVerifier{tokens: []string{"static"}, maxTTL: time.Hour}, valid, false, time.Time{}},
+		{"other secret", other, valid, false, time.Time{}},
+		{"expired", v, v.sign(now.Add(-time.Second)), false, time.Time{}},
+		{"expires at max ttl", v, v.sign(now.Add(time.Hour)), true, now.Add(time.Hour)},
+		{"longer than max ttl", v, v.sign(now.Add(time.Hour + time.Second)), false, time.Time{}},
+		{"far future", v, v.sign(now.AddDate(100, 0, 0)), false, time.Time{}},
+		{"tampered expiry", v, strconv.FormatInt(now.Add(20*time.Minute).Unix(), 10) + valid[len(expiry):], false, time.Time{}},
+		{"bad signature", v, expiry + ".00ff", false, time.Time{}},
+		{"non hex signature", v, expiry + ".zz", false, time.Time{}},
+		{"no signature", v, expiry, false, time.Time{}},
+		{"non numeric expiry", v, "soon." + hex.EncodeToString(v.signature("soon")), false, time.Time{}},
+	}
+	for _, tt := range tests {
+		exp, ok := tt.v.verify(tt.token, now)
+		if ok != tt.wantOk || !exp.Equal(tt.wantExp) {
+			t.Errorf("%s: verify(%q) = %v, %v; want %v, %v", tt.name, tt.token, exp, ok, tt.wantExp, tt.wantOk)
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	withSecret := debugVerifier{tokens: []string{"static"}, secret: []byte("secret"), maxTTL: time.Hour}
+	withoutSecret := debugVerifier{tokens: []string{"static"}, maxTTL: time.Hour}
+	tests := []struct {
+		name          string
+		v             debugVerifier
+		header        string
+		baggage       string
+		wantDebug     bool
+		wantPropagate bool
+	}{
+		{"no token", withSecret, "", "", false, false},
+		{"untrusted token", withSecret, "guess", "", false, false},
+		{"static token", withSecret, "static", "", true, true},
+		{"static token without a secret", withoutSecret, "static", "", true, false},
+		{"signed token", withSecret, withSecret.sign(time.Now().Add(30 * time.Minute)), "", true, true},
+		{"signed baggage", withSecret, "", withSecret.sign(time.Now().Add(30 * time.Minute)), true, true},
+		{"signed baggage that expires soon", withSecret, "", withSecret.sign(time.Now().Add(30 * time.Second)), true, true},
+		// A static token that an upstream service put into baggage is trusted, but is not propagated further.
+		{"static baggage without a secret", withoutSecret, "", "static", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				gotDebug bool
+				gotBag   baggage.Baggage
+			)
+			h := debugHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotDebug = isDebug(r.Context())
+				// Like the otelhttp handler, baggage is extracted from the request headers.
+				gotBag = baggage.FromContext(propagation.Baggage{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)))
+			}), tt.v)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(debugHeader, tt.header)
+			}
+			if tt.baggage != "" {
+				req.Header.Set("baggage", debugBaggageKey+"="+url.PathEscape(tt.baggage)+",team=x")
+			}
+			start := time.Now()
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotDebug != tt.wantDebug {
+				t.Errorf("isDebug() = %v, want %v", gotDebug, tt.wantDebug)
+			}
+			if tt.baggage != "" && gotBag.Member("team").Value() != "x" {
+				t.Errorf("other baggage members were not kept: %v", gotBag)
+			}
+
+			token := gotBag.Member(debugBaggageKey).Value()
+			if !tt.wantDebug {
+				if token != tt.baggage {
+					t.Errorf("baggage of a request that is not debugged was changed to %q", token)
+				}
+				return
+			}
+			if (token != "") != tt.wantPropagate {
+				t.Fatalf("propagated token = %q, want a token: %v", token, tt.wantPropagate)
+			}
+			if token == "" {
+				return
+			}
+			if token == tt.header {
+				t.Errorf("the token of the request was propagated: %q", token)
+			}
+			exp, ok := tt.v.verify(token, start)
+			if !ok {
+				t.Fatalf("propagated token %q is not trusted", token)
+			}
+			if exp.After(start.Add(debugPropagationTTL + time.Second)) {
+				t.Errorf("propagated token expires at %v, more than %v from now", exp, debugPropagationTTL)
+			}
+			if upstream, _ := tt.v.verify(tt.baggage, start); !upstream.IsZero() && exp.After(upstream) {
+				t.Errorf("propagated token expires at %v, after the upstream token %v", exp, upstream)
+			}
+		})
+	}
+}
+
+func TestDebugSampler(t *testing.T) {
+	s := debugSampler{next: trace.NeverSample()}
+	traceID := oteltrace.TraceID{1}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want trace.SamplingDecision
+	}{
+		{"not debugged", context.Background(), trace.Drop},
+		{"debugged", context.WithValue(context.Background(), debugCtxKey{}, true), trace.RecordAndSample},
+	}
+	for _, tt := range tests {
+		got := s.ShouldSample(trace.SamplingParameters{ParentContext: tt.ctx, TraceID: traceID, Name: "GET /"})
+		if got.Decision != tt.want {
+			t.Errorf("%s: ShouldSample() = %v, want %v", tt.name, got.Decision, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// drainTimeout is how long in-flight requests are given to complete, once shutdown starts.
+const drainTimeout = 15 * time.Second
+
+// withSignals returns a context that is cancelled when SIGINT or SIGTERM is received.
+// The signal is the cause of the cancellation; see context.Cause
+// After the first signal, the default behaviour is restored; so a second signal kills the process.
+func withSignals(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-ch:
+			cancel(fmt.Errorf("received signal: %s", sig))
+		case <-ctx.Done():
+		}
+		signal.Stop(ch)
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// serve runs server until ctx is done, then shuts it down gracefully;
+// it serves over TLS if server.TLSConfig is set.
+// it stops accepting connections & waits, for at most drainTimeout, for in-flight requests to complete.
+// The shutdown is traced & logged.
+func serve(ctx context.Context, server *http.Server, address string) error {
+	l := log.New(ctx)
+
+	errCh := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			l.Info("server listening", "address", address, "tls", true)
+			// The certificates come from server.TLSConfig.
+			errCh <- server.ListenAndServeTLS("", "")
+			return
+		}
+		l.Info("server listening", "address", address)
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		// The server failed before shutdown was asked for; eg, the port is in use.
+		return err
+	case <-ctx.Done():
+	}
+
+	cause := context.Cause(ctx)
+	// ctx is already cancelled, but the shutdown still needs a live context.
+	ctx, span := otel.Tracer(tracerName).Start(context.WithoutCancel(ctx), "server.shutdown")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("server.address", address),
+		attribute.String("shutdown.cause", cause.Error()),
+		attribute.String("shutdown.drain_timeout", drainTimeout.String()),
+	)
+
+	l = log.New(ctx)
+	l.Info("server shutting down", "address", address, "cause", cause, "drain_timeout", drainTimeout.String())
+
+	start := time.Now()
+	drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+	defer cancel()
+	if err := server.Shutdown(drainCtx); err != nil {
+		// Some requests did not complete in time; cut them off.
+		err = errors.Join(fmt.Errorf("failed to drain connections: %w", err), server.Close())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to drain connections")
+		l.Error("server shutdown failed", "address", address, "error", err, "duration", time.Since(start).String())
+		return err
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		span.RecordError(err)
+		l.Error("server failed", "address", address, "error", err)
+		return err
+	}
+
+	l.Info("server shut down", "address", address, "duration", time.Since(start).String())
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// freeAddress returns an address on the loopback interface that nothing listens on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestServeDrains(t *testing.T) {
+	address := freeAddress(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{
+		Addr: address,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = w.Write([]byte("done"))
+		}),
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- serve(ctx, server, address) }()
+
+	type result struct {
+		status int
+		err    error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		var res *http.Response
+		var err error
+		// The server may not be listening yet.
+		for i := 0; i < 50; i++ {
+			if res, err = http.Get("http://" + address); err == nil {
+				res.Body.Close()
+				resCh <- result{status: res.StatusCode}
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		resCh <- result{err: err}
+	}()
+
+	select {
+	case <-started:
+	case r := <-resCh:
+		t.Fatalf("request failed before it was handled: %v", r.err)
+	}
+	cancel(errors.New("received signal: terminated"))
+
+	// The in-flight request is drained, before serve returns.
+	select {
+	case err := <-serveErr:
+		t.Fatalf("serve() returned %v, while a request was in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+
+	if r := <-resCh; r.err != nil || r.status != http.StatusOK {
+		t.Errorf("in-flight request = %d, %v; want it to complete", r.status, r.err)
+	}
+	if err := <-serveErr; err != nil {
+		t.Errorf("serve() error = %v", err)
+	}
+	if _, err := http.Get("http://" + address); err == nil {
+		t.Error("the server still accepts connections after shutdown")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+
+	// The port is in use; serve returns without waiting for ctx.
+	address := ln.Addr().String()
+	err = serve(context.Background(), &http.Server{Addr: address}, address)
+	if err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Errorf("serve() error = %v, want address already in use", err)
+	}
+}
+
+func TestWithSignals(t *testing.T) {
+	ctx, stop := withSignals(context.Background())
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Kill() error = %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not cancelled by SIGTERM")
+	}
+	if cause := context.Cause(ctx); cause == nil || !strings.Contains(cause.Error(), "terminated") {
+		t.Errorf("context.Cause() = %v, want the signal", cause)
+	}
+
+	ctx, stop = withSignals(context.Background())
+	stop()
+	if !errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Errorf("context.Cause() after stop = %v, want %v", context.Cause(ctx), context.Canceled)
+	}
+}
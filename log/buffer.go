@@ -0,0 +1,242 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultBufferSize is the number of logs held by a Buffer, if no size is given.
+const DefaultBufferSize = 256
+
+// Buffer holds the trace & debug level logs of a request in memory, instead of writing them out.
+// They are written out, by Flush, only if the request fails; otherwise they are discarded.
+// This gives full detail on failures without paying for debug logs on every success.
+//
+// A Buffer is a ring buffer; once full, the oldest logs are dropped to make room for new ones.
+type Buffer struct {
+	mu      sync.Mutex
+	logs    []bufferedLog
+	next    int // index of the oldest log, once the buffer is full.
+	size    int
+	dropped int
+	failed  bool
+	done    bool
+}
+
+type bufferedLog struct {
+	w io.Writer
+	p []byte
+}
+
+type bufferCtxKey struct{}
+
+// NewBufferContext returns a context whose trace & debug level logs are held in the returned Buffer.
+// If size <= 0, DefaultBufferSize is used.
+//
+// usage:
+//
+//	ctx, buf := NewBufferContext(ctx, 0)
+//	defer buf.Close()
+//	l := New(ctx)
+//	l.Debug("hello world")
+//	if err != nil { buf.Fail() }
+func NewBufferContext(ctx context.Context, size int) (context.Context, *Buffer) {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	b := &Buffer{size: size}
+	return context.WithValue(ctx, bufferCtxKey{}, b), b
+}
+
+func bufferFromContext(ctx context.Context) *Buffer {
+	if ctx == nil {
+		return nil
+	}
+	b, _ := ctx.Value(bufferCtxKey{}).(*Buffer)
+	return b
+}
+
+// isBuffered reports whether logs of level lvl are held in a Buffer.
+func isBuffered(lvl Level) bool {
+	return lvl < InfoLevel
+}
+
+// add holds a copy of p, which is to be written to w on Flush.
+// It reports false if the buffer has already been flushed or discarded, in which case p should be written to w directly.
+func (b *Buffer) add(w io.Writer, p []byte) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.done {
+		return false
+	}
+
+	l := bufferedLog{w: w, p: append([]byte(nil), p...)}
+	if len(b.logs) < b.size {
+		b.logs = append(b.logs, l)
+		return true
+	}
+	b.logs[b.next] = l
+	b.next = (b.next + 1) % b.size
+	b.dropped++
+	return true
+}
+
+// Fail marks the request as failed, so that Close flushes the buffered logs.
+func (b *Buffer) Fail() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failed = true
+}
+
+// Failed reports whether Fail has been called.
+func (b *Buffer) Failed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failed
+}
+
+// Dropped returns the number of logs that were dropped because the buffer was full.
+func (b *Buffer) Dropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dropped
+}
+
+// Flush writes out the buffered logs, oldest first. Logs made after Flush are written out directly.
+func (b *Buffer) Flush() error {
+	b.mu.Lock()
+	logs := append(b.logs[b.next:len(b.logs):len(b.logs)], b.logs[:b.next]...)
+	b.logs, b.next, b.done = nil, 0, true
+	b.mu.Unlock()
+
+	var errs []error
+	for _, l := range logs {
+		if _, err := l.w.Write(l.p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Discard drops the buffered logs. Logs made after Discard are written out directly.
+func (b *Buffer) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.logs, b.next, b.done = nil, 0, true
+}
+
+// Close flushes the buffered logs if the request failed, otherwise it discards them.
+func (b *Buffer) Close() error {
+	if b.Failed() {
+		return b.Flush()
+	}
+	b.Discard()
+	return nil
+}
+
+// bufferWriter is an io.Writer that holds the writes in a Buffer.
+type bufferWriter struct {
+	b *Buffer
+	w io.Writer
+}
+
+func (bw bufferWriter) Write(p []byte) (int, error) {
+	if bw.b.add(bw.w, p) {
+		return len(p), nil
+	}
+	return bw.w.Write(p)
+}
+
+// failBuffer marks the Buffer in ctx, if any, as failed if lvl is ErrorLevel or above.
+func failBuffer(ctx context.Context, lvl Level) {
+	if lvl < ErrorLevel {
+		return
+	}
+	if b := bufferFromContext(ctx); b != nil {
+		b.Fail()
+	}
+}
+
+// spanBuffers holds the *Buffer, if any, of each span(keyed by trace.SpanID) that was started with a Buffer in its context.
+// If such a span ends with an error status, the Buffer is marked as failed; see SpanProcessor.
+var spanBuffers sync.Map
+
+func trackSpanBuffer(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if b := bufferFromContext(parent); b != nil {
+		spanBuffers.Store(s.SpanContext().SpanID(), b)
+	}
+}
+
+func untrackSpanBuffer(s sdktrace.ReadOnlySpan) {
+	v, ok := spanBuffers.LoadAndDelete(s.SpanContext().SpanID())
+	if !ok {
+		return
+	}
+	if s.Status().Code == codes.Error {
+		v.(*Buffer).Fail()
+	}
+}
+
+// BufferHandler returns a http.Handler that holds the trace & debug level logs of each request in a Buffer of the given size.
+// The logs are written out only if the response has a 5xx status code, h panics, an error level log is made
+// or a span of the request ends with an error status. Otherwise they are discarded.
+// A panic of h is re-raised once the logs are written out.
+// Requests whose level was lowered via ContextWithLevel are not buffered.
+//
+// It should wrap h inside of the otelhttp handler, so that requests have a span:
+//
+//	handler := otelhttp.NewHandler(log.BufferHandler(mux, 0), "server.http")
+func BufferHandler(h http.Handler, size int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(levelCtxKey{}).(Level); ok {
+			// The level of this request has been lowered on purpose, so its logs are wanted.
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, b := NewBufferContext(r.Context(), size)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			p := recover()
+			if p != nil || sw.status >= http.StatusInternalServerError {
+				b.Fail()
+			}
+			if s, ok := trace.SpanFromContext(ctx).(sdktrace.ReadOnlySpan); ok && s.Status().Code == codes.Error {
+				b.Fail()
+			}
+			_ = b.Close()
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		h.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
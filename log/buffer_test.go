@@ -0,0 +1,152 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBufferRing(t *testing.T) {
+	_, b := NewBufferContext(context.Background(), 3)
+	var out bytes.Buffer
+	for i := 1; i <= 5; i++ {
+		if !b.add(&out, []byte(fmt.Sprintf("%d\n", i))) {
+			t.Fatalf("add(%d) = false, want true", i)
+		}
+	}
+	if out.Len() != 0 {
+		t.Fatalf("logs were written out before Flush: %q", out.String())
+	}
+	if b.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", b.Dropped())
+	}
+
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	// The oldest logs are evicted; the rest are written out oldest first.
+	if got := out.String(); got != "3\n4\n5\n" {
+		t.Errorf("Flush() wrote %q, want %q", got, "3\n4\n5\n")
+	}
+	if b.add(&out, []byte("6\n")) {
+		t.Error("add() after Flush = true, want false")
+	}
+}
+
+func TestBufferClose(t *testing.T) {
+	for _, fail := range []bool{true, false} {
+		_, b := NewBufferContext(context.Background(), 0)
+		var out bytes.Buffer
+		b.add(&out, []byte("debug\n"))
+		if fail {
+			b.Fail()
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if got := out.String() == "debug\n"; got != fail {
+			t.Errorf("failed = %v: wrote %q", fail, out.String())
+		}
+	}
+}
+
+func TestBufferHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   func(http.ResponseWriter, *http.Request)
+		ctx       func(context.Context) context.Context
+		wantPanic bool
+		wantDebug bool
+	}{
+		{
+			name: "success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				New(r.Context()).Debug("debug detail")
+			},
+		},
+		{
+			name: "5xx",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				New(r.Context()).Debug("debug detail")
+				w.WriteHeader(http.StatusBadGateway)
+			},
+			wantDebug: true,
+		},
+		{
+			name: "4xx",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				New(r.Context()).Debug("debug detail")
+				w.WriteHeader(http.StatusNotFound)
+			},
+		},
+		{
+			name: "panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				New(r.Context()).Debug("debug detail")
+				panic("serviceB is down")
+			},
+			wantPanic: true,
+			wantDebug: true,
+		},
+		{
+			name: "error log",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				l := New(r.Context())
+				l.Debug("debug detail")
+				l.Error("failed")
+			},
+			wantDebug: true,
+		},
+		{
+			name: "span error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				New(r.Context()).Debug("debug detail")
+				trace.SpanFromContext(r.Context()).SetStatus(codes.Error, "failed")
+			},
+			wantDebug: true,
+		},
+		{
+			name: "lowered level",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				New(r.Context()).Debug("debug detail")
+			},
+			ctx:       func(ctx context.Context) context.Context { return ContextWithLevel(ctx, DebugLevel) },
+			wantDebug: true,
+		},
+	}
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				c, output := fileConfig(t, backend)
+				c.Level = DebugLevel
+				setTestConfig(t, c)
+				ctx, span, _ := startSpan(t)
+				defer span.End()
+				if tt.ctx != nil {
+					ctx = tt.ctx(ctx)
+				}
+
+				var panicked any
+				func() {
+					defer func() { panicked = recover() }()
+					req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+					BufferHandler(http.HandlerFunc(tt.handler), 0).ServeHTTP(httptest.NewRecorder(), req)
+				}()
+
+				if (panicked != nil) != tt.wantPanic {
+					t.Errorf("panicked = %v, want a panic: %v", panicked, tt.wantPanic)
+				}
+				if got := strings.Contains(readFile(t, output), "debug detail"); got != tt.wantDebug {
+					t.Errorf("debug log written = %v, want %v", got, tt.wantDebug)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// FormatJSON emits one json object per log line.
+	FormatJSON = "json"
+	// FormatText emits human readable console text.
+	FormatText = "text"
+)
+
+// Config is the logging configuration that is applied uniformly to logrus, zerolog & slog.
+type Config struct {
+	ServiceName string `json:"serviceName"` // name of the service that is logging.
+
+	Backend string            `json:"backend"` // the backend used by New; one of; logrus, zerolog, slog
+	Level   Level             `json:"level"`
+	Format  string            `json:"format"` // one of; json, text
+	Schema  string            `json:"schema"` // the top-level keys of logs; one of; native, normalized. It should only be set at startup.
+	Output  string            `json:"output"` // one of; stdout, stderr or a file path.
+	Caller  bool              `json:"caller"` // report the file & line of the log call.
+	Fields  map[string]string `json:"fields"` // static fields added to every log line.
+
+	TraceFormat  string `json:"traceFormat"`  // format of the trace correlation fields; one of; default, w3c, ecs, gcp, datadog
+	GCPProjectID string `json:"gcpProjectId"` // google cloud project, needed by the gcp trace format.
+
+	SpanEvents SpanEventsConfig `json:"spanEvents"`
+}
+
+// DefaultConfig is the configuration used if none is set.
+func DefaultConfig() Config {
+	return Config{
+		Backend: BackendLogrus,
+		Level:   TraceLevel,
+		Format:  FormatJSON,
+		Schema:  SchemaNative,
+		Output:  "stdout",
+		Caller:  true,
+		Fields:  map[string]string{},
+
+		TraceFormat: TraceFormatDefault,
+		SpanEvents: SpanEventsConfig{
+			MinLevel:   TraceLevel,
+			MaxPerSpan: 128,
+			Dedup:      true,
+		},
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by the following environment variables(if set);
+// OTERO_LOG_BACKEND, OTERO_LOG_LEVEL, OTERO_LOG_FORMAT, OTERO_LOG_SCHEMA, OTERO_LOG_OUTPUT, OTERO_LOG_CALLER, OTERO_LOG_FIELDS,
+// OTERO_LOG_SPAN_EVENTS_LEVEL, OTERO_LOG_SPAN_EVENTS_MAX, OTERO_LOG_SPAN_EVENTS_DEDUP,
+// OTERO_LOG_TRACE_FORMAT & OTERO_LOG_GCP_PROJECT(or GOOGLE_CLOUD_PROJECT).
+//
+// OTERO_LOG_FIELDS is a comma separated list of key=value pairs.
+func ConfigFromEnv() (Config, error) {
+	c := DefaultConfig()
+
+	if v := os.Getenv("OTERO_LOG_BACKEND"); v != "" {
+		c.Backend = v
+	}
+	if v := os.Getenv("OTERO_LOG_LEVEL"); v != "" {
+		lvl, err := ParseLevel(v)
+		if err != nil {
+			return c, err
+		}
+		c.Level = lvl
+	}
+	if v := os.Getenv("OTERO_LOG_FORMAT"); v != "" {
+		c.Format = v
+	}
+	if v := os.Getenv("OTERO_LOG_SCHEMA"); v != "" {
+		c.Schema = v
+	}
+	if v := os.Getenv("OTERO_LOG_OUTPUT"); v != "" {
+		c.Output = v
+	}
+	if v := os.Getenv("OTERO_LOG_CALLER"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("log: invalid OTERO_LOG_CALLER: %w", err)
+		}
+		c.Caller = b
+	}
+	if v := os.Getenv("OTERO_LOG_FIELDS"); v != "" {
+		f, err := ParseFields(v)
+		if err != nil {
+			return c, err
+		}
+		c.Fields = f
+	}
+	if v := os.Getenv("OTERO_LOG_TRACE_FORMAT"); v != "" {
+		c.TraceFormat = v
+	}
+	if v := os.Getenv("OTERO_LOG_GCP_PROJECT"); v != "" {
+		c.GCPProjectID = v
+	} else if v := os.Getenv("GOOGLE_CLOUD_PROJECT"); v != "" {
+		c.GCPProjectID = v
+	}
+	if v := os.Getenv("OTERO_LOG_SPAN_EVENTS_LEVEL"); v != "" {
+		lvl, err := ParseLevel(v)
+		if err != nil {
+			return c, err
+		}
+		c.SpanEvents.MinLevel = lvl
+	}
+	if v := os.Getenv("OTERO_LOG_SPAN_EVENTS_MAX"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return c, fmt.Errorf("log: invalid OTERO_LOG_SPAN_EVENTS_MAX: %w", err)
+		}
+		c.SpanEvents.MaxPerSpan = n
+	}
+	if v := os.Getenv("OTERO_LOG_SPAN_EVENTS_DEDUP"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("log: invalid OTERO_LOG_SPAN_EVENTS_DEDUP: %w", err)
+		}
+		c.SpanEvents.Dedup = b
+	}
+
+	return c, c.validate()
+}
+
+// ParseFields parses a comma separated list of key=value pairs.
+func ParseFields(s string) (map[string]string, error) {
+	fields := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("log: invalid field %q, expected key=value", kv)
+		}
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+// FormatFields is the inverse of ParseFields.
+func FormatFields(fields map[string]string) string {
+	kvs := make([]string, 0, len(fields))
+	for _, k := range sortedKeys(fields) {
+		kvs = append(kvs, k+"="+fields[k])
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (c Config) validate() error {
+	switch c.Backend {
+	case BackendLogrus, BackendZerolog, BackendSlog:
+	default:
+		return fmt.Errorf("log: unknown backend %q, expected one of; %s, %s, %s", c.Backend, BackendLogrus, BackendZerolog, BackendSlog)
+	}
+	if c.Level < TraceLevel || c.Level > FatalLevel {
+		return fmt.Errorf("log: unknown level %d", c.Level)
+	}
+	if c.Format != FormatJSON && c.Format != FormatText {
+		return fmt.Errorf("log: unknown format %q, expected one of; %s, %s", c.Format, FormatJSON, FormatText)
+	}
+	if !validSchema(c.Schema) {
+		return fmt.Errorf("log: unknown schema %q, expected one of; %s, %s", c.Schema, SchemaNative, SchemaNormalized)
+	}
+	if c.Output == "" {
+		return fmt.Errorf("log: output should not be empty")
+	}
+	if !validTraceFormat(c.TraceFormat) {
+		return fmt.Errorf("log: unknown trace format %q, expected one of; %s, %s, %s, %s, %s",
+			c.TraceFormat, TraceFormatDefault, TraceFormatW3C, TraceFormatECS, TraceFormatGCP, TraceFormatDatadog)
+	}
+	if c.TraceFormat == TraceFormatGCP && c.GCPProjectID == "" {
+		return fmt.Errorf("log: the %s trace format needs a google cloud project id", TraceFormatGCP)
+	}
+	if c.SpanEvents.MinLevel < TraceLevel || c.SpanEvents.MinLevel > FatalLevel {
+		return fmt.Errorf("log: unknown span events level %d", c.SpanEvents.MinLevel)
+	}
+	if c.SpanEvents.MaxPerSpan < 0 {
+		return fmt.Errorf("log: span events max(%d) should not be negative", c.SpanEvents.MaxPerSpan)
+	}
+	return nil
+}
+
+var (
+	mu  sync.RWMutex
+	cfg Config
+	// out is the writer of all loggers. It is never replaced, only the output that it writes to is.
+	out = &output{w: os.Stdout}
+)
+
+// output is an io.Writer that writes to the configured output; stdout, stderr or a file.
+// Loggers hold on to it, rather than to the output itself; so that those created before the output was changed
+// (eg, the logger of an in-flight request or a Buffer) write to the new output, instead of to a closed file.
+type output struct {
+	mu sync.RWMutex
+	w  io.Writer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.w.Write(p)
+}
+
+// swap makes o write to w, and returns the writer that it wrote to before.
+// No write to the previous writer is in progress once swap returns, so it can be closed.
+func (o *output) swap(w io.Writer) io.Writer {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	prev := o.w
+	o.w = w
+	return prev
+}
+
+func init() {
+	if err := SetConfig(DefaultConfig()); err != nil {
+		panic(err)
+	}
+}
+
+// SetConfig applies c to all the logging backends.
+// It is safe to call at runtime; loggers created after the call use the new configuration,
+// and all loggers write to the new output.
+func SetConfig(c Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	w, err := openOutput(c.Output)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	cfg = c
+	setupLogrus(c, out)
+	setupZerolog(c, out)
+	setupSlog(c, out)
+
+	if f, ok := out.swap(w).(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		_ = f.Close()
+	}
+
+	return nil
+}
+
+// GetConfig returns the configuration currently in use.
+func GetConfig() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c := cfg
+	c.Fields = make(map[string]string, len(cfg.Fields))
+	for k, v := range cfg.Fields {
+		c.Fields[k] = v
+	}
+	return c
+}
+
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("log: unable to open output: %w", err)
+		}
+		return f, nil
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AdminHandler is a http handler that can be used to view & change the logging configuration at runtime.
+// The output, service name & schema can not be changed via it; see checkRuntimeChange.
+//
+// It does no authentication, so it should be served on a listener that is only reachable from the host;
+// not on the one that serves the public endpoints.
+//
+// usage:
+//
+//	curl -vkL http://127.0.0.1:9081/admin/log
+//	curl -vkL -XPUT http://127.0.0.1:9081/admin/log -d '{"level": "info", "format": "text"}'
+func AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			// Fields that are not in the request body retain their current values.
+			cur := GetConfig()
+			c, err := decodeConfig(r.Body, GetConfig())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := checkRuntimeChange(cur, c); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := SetConfig(c); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(GetConfig())
+	})
+}
+
+// decodeConfig decodes the json config in r over c.
+// The static fields in r replace those of c, rather than being merged into them; so that fields can be removed.
+func decodeConfig(r io.Reader, c Config) (Config, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return c, err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return c, err
+	}
+	for k := range keys {
+		// encoding/json matches keys case-insensitively.
+		if strings.EqualFold(k, "fields") {
+			c.Fields = nil
+		}
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// checkRuntimeChange returns an error if c changes a setting of cur that can only be set at startup.
+//   - Output; it would let anyone that can reach AdminHandler create or append to any file.
+//   - ServiceName; it identifies the service in logs & metrics.
+//   - Schema; zerolog reads its keys from package-level variables, which can not be changed while it is logging.
+func checkRuntimeChange(cur, c Config) error {
+	if c.Output != cur.Output {
+		return fmt.Errorf("log: output can only be set at startup")
+	}
+	if c.ServiceName != cur.ServiceName {
+		return fmt.Errorf("log: serviceName can only be set at startup")
+	}
+	if c.Schema != cur.Schema {
+		return fmt.Errorf("log: schema can only be set at startup")
+	}
+	return nil
+}
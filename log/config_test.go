@@ -0,0 +1,225 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setTestConfig applies c for the duration of the test. The logging configuration is global, so tests that use it do not run in parallel.
+func setTestConfig(t *testing.T, c Config) {
+	t.Helper()
+
+	prev := GetConfig()
+	if err := SetConfig(c); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+	t.Cleanup(func() {
+		if err := SetConfig(prev); err != nil {
+			t.Fatalf("SetConfig() error = %v", err)
+		}
+	})
+}
+
+// fileConfig returns DefaultConfig, with backend & an output file in a temporary directory.
+func fileConfig(t *testing.T, backend string) (Config, string) {
+	t.Helper()
+
+	c := DefaultConfig()
+	c.Backend = backend
+	c.Output = filepath.Join(t.TempDir(), "out.log")
+	return c, c.Output
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return string(b)
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "app=demo", want: map[string]string{"app": "demo"}},
+		{in: " app=demo , team=x,", want: map[string]string{"app": "demo", "team": "x"}},
+		{in: "url=http://x?a=b", want: map[string]string{"url": "http://x?a=b"}},
+		{in: "app", wantErr: true},
+		{in: "=demo", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFields(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFields(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFields(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	fields := map[string]string{"team": "x", "app": "demo"}
+	if got := FormatFields(fields); got != "app=demo,team=x" {
+		t.Errorf("FormatFields() = %q", got)
+	}
+	if got, _ := ParseFields(FormatFields(fields)); !reflect.DeepEqual(got, fields) {
+		t.Errorf("ParseFields(FormatFields()) = %v, want %v", got, fields)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OTERO_LOG_BACKEND", BackendZerolog)
+	t.Setenv("OTERO_LOG_LEVEL", "warn")
+	t.Setenv("OTERO_LOG_FORMAT", FormatText)
+	t.Setenv("OTERO_LOG_CALLER", "false")
+	t.Setenv("OTERO_LOG_FIELDS", "app=demo")
+	t.Setenv("OTERO_LOG_SPAN_EVENTS_MAX", "7")
+
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv() error = %v", err)
+	}
+	if c.Backend != BackendZerolog || c.Level != WarnLevel || c.Format != FormatText || c.Caller ||
+		c.Fields["app"] != "demo" || c.SpanEvents.MaxPerSpan != 7 {
+		t.Errorf("ConfigFromEnv() = %+v", c)
+	}
+
+	t.Setenv("OTERO_LOG_CALLER", "maybe")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("ConfigFromEnv() with an invalid OTERO_LOG_CALLER; expected an error")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"backend", func(c *Config) { c.Backend = "log4j" }},
+		{"level", func(c *Config) { c.Level = 42 }},
+		{"format", func(c *Config) { c.Format = "xml" }},
+		{"schema", func(c *Config) { c.Schema = "ecs" }},
+		{"output", func(c *Config) { c.Output = "" }},
+		{"trace format", func(c *Config) { c.TraceFormat = "zipkin" }},
+		{"gcp project", func(c *Config) { c.TraceFormat = TraceFormatGCP }},
+		{"span events max", func(c *Config) { c.SpanEvents.MaxPerSpan = -1 }},
+	}
+	for _, tt := range tests {
+		c := DefaultConfig()
+		tt.modify(&c)
+		if err := c.validate(); err == nil {
+			t.Errorf("%s: validate() expected an error", tt.name)
+		}
+	}
+
+	if err := DefaultConfig().validate(); err != nil {
+		t.Errorf("DefaultConfig().validate() error = %v", err)
+	}
+}
+
+func TestSetConfigOutput(t *testing.T) {
+	for _, backend := range []string{BackendLogrus, BackendZerolog, BackendSlog} {
+		t.Run(backend, func(t *testing.T) {
+			c, first := fileConfig(t, backend)
+			setTestConfig(t, c)
+
+			// Created before the output is changed, like the logger of an in-flight request.
+			l := New(context.Background())
+			ctx, buf := NewBufferContext(context.Background(), 0)
+			buffered := New(ctx)
+			buffered.Debug("buffered before the change")
+
+			c.Output = filepath.Join(t.TempDir(), "second.log")
+			if err := SetConfig(c); err != nil {
+				t.Fatalf("SetConfig() error = %v", err)
+			}
+			l.Info("after the change")
+			buf.Fail()
+			if err := buf.Close(); err != nil {
+				t.Fatalf("Buffer.Close() error = %v", err)
+			}
+
+			if got := readFile(t, first); strings.Contains(got, "after the change") || strings.Contains(got, "buffered before the change") {
+				t.Errorf("the previous output was written to after the change: %s", got)
+			}
+			got := readFile(t, c.Output)
+			for _, want := range []string{"after the change", "buffered before the change"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("new output does not contain %q: %s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	c, _ := fileConfig(t, BackendLogrus)
+	c.ServiceName = "svc"
+	c.Fields = map[string]string{"app": "x", "team": "y"}
+	setTestConfig(t, c)
+	h := AdminHandler()
+
+	tests := []struct {
+		method, body string
+		wantStatus   int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodPut, `{"level": "info", "format": "text"}`, http.StatusOK},
+		// The fields are replaced, so that app is removed.
+		{http.MethodPut, `{"fields": {"team": "z"}}`, http.StatusOK},
+		{http.MethodPut, `{"output": "/tmp/elsewhere.log"}`, http.StatusBadRequest},
+		{http.MethodPut, `{"serviceName": "impostor"}`, http.StatusBadRequest},
+		{http.MethodPut, `{"schema": "normalized"}`, http.StatusBadRequest},
+		{http.MethodPut, `{"format": "xml"}`, http.StatusBadRequest},
+		{http.MethodPut, `{`, http.StatusBadRequest},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, "/admin/log", strings.NewReader(tt.body)))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d; %s", tt.method, tt.body, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+
+	got := GetConfig()
+	if got.Level != InfoLevel || got.Format != FormatText {
+		t.Errorf("level & format were not changed: %+v", got)
+	}
+	if got.Output != c.Output || got.ServiceName != c.ServiceName {
+		t.Errorf("output or service name were changed: %+v", got)
+	}
+	if !reflect.DeepEqual(got.Fields, map[string]string{"team": "z"}) {
+		t.Errorf("fields = %v, want only team=z", got.Fields)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/log", nil))
+	var resp Config
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error = %v", err)
+	}
+	if resp.Level != InfoLevel {
+		t.Errorf("GET level = %v, want %v", resp.Level, InfoLevel)
+	}
+
+	// All the fields can be removed.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/log", strings.NewReader(`{"fields": {}}`)))
+	if got := GetConfig(); w.Code != http.StatusOK || len(got.Fields) != 0 {
+		t.Errorf("PUT empty fields: status = %d & fields = %v, want none", w.Code, got.Fields)
+	}
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The formats of the log fields that correlate logs with traces.
+// Log backends can link logs to traces natively, if the fields are in the format they expect.
+const (
+	// TraceFormatDefault uses the `traceId` & `spanId` fields.
+	TraceFormatDefault = "default"
+	// TraceFormatW3C uses the `trace_id`, `span_id` & `trace_flags` fields.
+	// See: https://www.w3.org/TR/trace-context/
+	TraceFormatW3C = "w3c"
+	// TraceFormatECS uses the `trace.id` & `span.id` fields.
+	// See: https://www.elastic.co/guide/en/ecs/current/ecs-tracing.html
+	TraceFormatECS = "ecs"
+	// TraceFormatGCP uses the `logging.googleapis.com/trace`, `logging.googleapis.com/spanId` & `logging.googleapis.com/trace_sampled` fields.
+	// See: https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+	TraceFormatGCP = "gcp"
+	// TraceFormatDatadog uses the `dd.trace_id` & `dd.span_id` fields.
+	// See: https://docs.datadoghq.com/tracing/other_telemetry/connect_logs_and_traces/opentelemetry/
+	TraceFormatDatadog = "datadog"
+)
+
+func validTraceFormat(f string) bool {
+	switch f {
+	case TraceFormatDefault, TraceFormatW3C, TraceFormatECS, TraceFormatGCP, TraceFormatDatadog:
+		return true
+	default:
+		return false
+	}
+}
+
+// correlationFields returns the log fields that correlate a log with the span whose context is sCtx.
+func correlationFields(sCtx trace.SpanContext) []attribute.KeyValue {
+	mu.RLock()
+	format, gcpProject := cfg.TraceFormat, cfg.GCPProjectID
+	mu.RUnlock()
+
+	if !sCtx.HasTraceID() || !sCtx.HasSpanID() {
+		return nil
+	}
+	traceID, spanID := sCtx.TraceID(), sCtx.SpanID()
+
+	switch format {
+	case TraceFormatW3C:
+		return []attribute.KeyValue{
+			attribute.String("trace_id", traceID.String()),
+			attribute.String("span_id", spanID.String()),
+			attribute.String("trace_flags", sCtx.TraceFlags().String()),
+		}
+	case TraceFormatECS:
+		return []attribute.KeyValue{
+			attribute.String("trace.id", traceID.String()),
+			attribute.String("span.id", spanID.String()),
+		}
+	case TraceFormatGCP:
+		return []attribute.KeyValue{
+			attribute.String("logging.googleapis.com/trace", fmt.Sprintf("projects/%s/traces/%s", gcpProject, traceID)),
+			attribute.String("logging.googleapis.com/spanId", spanID.String()),
+			attribute.Bool("logging.googleapis.com/trace_sampled", sCtx.IsSampled()),
+		}
+	case TraceFormatDatadog:
+		// Datadog ids are the lower 64 bits of the otel ids, in decimal.
+		return []attribute.KeyValue{
+			attribute.String("dd.trace_id", strconv.FormatUint(binary.BigEndian.Uint64(traceID[8:]), 10)),
+			attribute.String("dd.span_id", strconv.FormatUint(binary.BigEndian.Uint64(spanID[:]), 10)),
+		}
+	default:
+		return []attribute.KeyValue{
+			attribute.String("traceId", traceID.String()),
+			attribute.String("spanId", spanID.String()),
+		}
+	}
+}
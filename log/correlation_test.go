@@ -0,0 +1,76 @@
+package log
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCorrelationFields(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	sCtx := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+
+	tests := []struct {
+		format string
+		want   []attribute.KeyValue
+	}{
+		{TraceFormatDefault, []attribute.KeyValue{
+			attribute.String("traceId", "0af7651916cd43dd8448eb211c80319c"),
+			attribute.String("spanId", "b7ad6b7169203331"),
+		}},
+		{TraceFormatW3C, []attribute.KeyValue{
+			attribute.String("trace_id", "0af7651916cd43dd8448eb211c80319c"),
+			attribute.String("span_id", "b7ad6b7169203331"),
+			attribute.String("trace_flags", "01"),
+		}},
+		{TraceFormatECS, []attribute.KeyValue{
+			attribute.String("trace.id", "0af7651916cd43dd8448eb211c80319c"),
+			attribute.String("span.id", "b7ad6b7169203331"),
+		}},
+		{TraceFormatGCP, []attribute.KeyValue{
+			attribute.String("logging.googleapis.com/trace", "projects/my-project/traces/0af7651916cd43dd8448eb211c80319c"),
+			attribute.String("logging.googleapis.com/spanId", "b7ad6b7169203331"),
+			attribute.Bool("logging.googleapis.com/trace_sampled", true),
+		}},
+		// The lower 64 bits; 0x8448eb211c80319c & 0xb7ad6b7169203331
+		{TraceFormatDatadog, []attribute.KeyValue{
+			attribute.String("dd.trace_id", "9532127138774266268"),
+			attribute.String("dd.span_id", "13235353014750950193"),
+		}},
+	}
+	for _, tt := range tests {
+		c := DefaultConfig()
+		c.TraceFormat = tt.format
+		c.GCPProjectID = "my-project"
+		setTestConfig(t, c)
+
+		if got := correlationFields(sCtx); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: correlationFields() = %v, want %v", tt.format, got, tt.want)
+		}
+		if got := correlationFields(trace.SpanContext{}); got != nil {
+			t.Errorf("%s: correlationFields() of an invalid span context = %v, want nil", tt.format, got)
+		}
+	}
+}
+
+func TestTraceFormatInLogs(t *testing.T) {
+	for _, backend := range backends {
+		c, output := fileConfig(t, backend)
+		c.TraceFormat = TraceFormatECS
+		setTestConfig(t, c)
+		ctx, span, _ := startSpan(t)
+
+		New(ctx).Info("hello")
+		span.End()
+
+		got := readFile(t, output)
+		want := `"trace.id":"` + span.SpanContext().TraceID().String() + `"`
+		if !strings.Contains(got, want) || strings.Contains(got, `"traceId"`) {
+			t.Errorf("%s: log does not have the ecs trace fields: %s", backend, got)
+		}
+	}
+}
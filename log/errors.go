@@ -0,0 +1,152 @@
+package log
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/komuw/otero/log/internal/attrconv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	exceptionCauseTypeKey    = attribute.Key("exception.cause.type")
+	exceptionCauseMessageKey = attribute.Key("exception.cause.message")
+)
+
+// maxErrorChain bounds how many wrapped errors are unwrapped into the attributes of an exception event.
+const maxErrorChain = 16
+
+// recordErrors records each of errs on span as an exception event(like span.RecordError does) & sets the span status.
+//
+// For logs of ErrorLevel & above, stack is added to the exception event of the first error.
+// If there are no errors, such logs get an exception event of their own.
+func recordErrors(span trace.Span, errs []error, lvl Level, msg, stack string) {
+	if lvl < ErrorLevel {
+		stack = ""
+	}
+
+	for i, err := range errs {
+		s := ""
+		if i == 0 {
+			s = stack
+		}
+		addExceptionEvent(span, err, msg, s)
+	}
+
+	switch {
+	case lvl >= ErrorLevel:
+		if len(errs) == 0 {
+			addExceptionEvent(span, nil, msg, stack)
+		}
+		span.SetStatus(codes.Error, msg)
+	case len(errs) > 0:
+		span.SetStatus(codes.Error, errs[0].Error())
+	}
+}
+
+// addExceptionEvent adds a semconv exception event to span.
+// The types & messages of the errors wrapped by err are added as the `exception.cause.type` & `exception.cause.message` attributes.
+func addExceptionEvent(span trace.Span, err error, msg, stack string) {
+	typ := "log"
+	if err != nil {
+		typ = reflect.TypeOf(err).String()
+		msg = err.Error()
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.ExceptionTypeKey.String(typ),
+		semconv.ExceptionMessageKey.String(msg),
+	}
+	if stack != "" {
+		attrs = append(attrs, semconv.ExceptionStacktraceKey.String(stack))
+	}
+	if causes := unwrapAll(err); len(causes) > 0 {
+		types := make([]string, 0, len(causes))
+		msgs := make([]string, 0, len(causes))
+		for _, c := range causes {
+			types = append(types, reflect.TypeOf(c).String())
+			msgs = append(msgs, c.Error())
+		}
+		attrs = append(attrs,
+			exceptionCauseTypeKey.StringSlice(types),
+			exceptionCauseMessageKey.StringSlice(msgs),
+		)
+	}
+
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(attrs...))
+}
+
+// unwrapAll returns the errors wrapped by err, outermost first.
+// It understands both `Unwrap() error` & `Unwrap() []error`(ie, errors.Join).
+func unwrapAll(err error) []error {
+	var causes []error
+	queue := directCauses(err)
+	for len(queue) > 0 && len(causes) < maxErrorChain {
+		c := queue[0]
+		queue = queue[1:]
+		if c == nil || attrconv.IsNilPointer(c) {
+			continue
+		}
+		causes = append(causes, c)
+		queue = append(queue, directCauses(c)...)
+	}
+	return causes
+}
+
+func directCauses(err error) []error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return []error{e.Unwrap()}
+	case interface{ Unwrap() []error }:
+		return e.Unwrap()
+	default:
+		return nil
+	}
+}
+
+// findErrors returns the error values in fields.
+// The one under the conventional `error` key comes first. Nil pointers, eg a nil *os.PathError, are left out.
+func findErrors(fields map[string]any) []error {
+	var errs []error
+	if err, ok := fields["error"].(error); ok && !attrconv.IsNilPointer(err) {
+		errs = append(errs, err)
+	}
+	for _, k := range sortedKeys(fields) {
+		if k == "error" {
+			continue
+		}
+		if err, ok := fields[k].(error); ok && !attrconv.IsNilPointer(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func firstError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+type logFieldsCtxKey struct{}
+
+// contextWithLogFields is used to hand over the fields of a log call to the zerolog hook,
+// since zerolog hooks have no access to the fields of an event.
+func contextWithLogFields(ctx context.Context, fields map[string]any) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, logFieldsCtxKey{}, fields)
+}
+
+func logFieldsFromContext(ctx context.Context) map[string]any {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsCtxKey{}).(map[string]any)
+	return fields
+}
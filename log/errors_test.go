@@ -0,0 +1,146 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestUnwrapAll(t *testing.T) {
+	joined := errors.Join(io.EOF, fs.ErrNotExist)
+	tests := []struct {
+		name string
+		err  error
+		want []error
+	}{
+		{"nil", nil, nil},
+		{"plain", io.EOF, nil},
+		{"wrapped", fmt.Errorf("a: %w", fmt.Errorf("b: %w", io.EOF)), []error{fmt.Errorf("b: %w", io.EOF), io.EOF}},
+		{"joined", fmt.Errorf("a: %w", joined), []error{joined, io.EOF, fs.ErrNotExist}},
+		{"nil pointer cause", fmt.Errorf("a: %w", (*fs.PathError)(nil)), nil},
+	}
+	for _, tt := range tests {
+		got := unwrapAll(tt.err)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: unwrapAll() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var deep error = io.EOF
+	for i := 0; i < 2*maxErrorChain; i++ {
+		deep = fmt.Errorf("%d: %w", i, deep)
+	}
+	if n := len(unwrapAll(deep)); n != maxErrorChain {
+		t.Errorf("unwrapAll() of a long chain returned %d errors, want %d", n, maxErrorChain)
+	}
+}
+
+func TestFindErrors(t *testing.T) {
+	var nilErr *fs.PathError
+	fields := map[string]any{"b": io.EOF, "error": fs.ErrNotExist, "a": fs.ErrExist, "n": 1, "nil": error(nilErr)}
+	want := []error{fs.ErrNotExist, fs.ErrExist, io.EOF}
+	if got := findErrors(fields); !reflect.DeepEqual(got, want) {
+		t.Errorf("findErrors() = %v, want %v", got, want)
+	}
+}
+
+func TestErrorsAreExceptionEvents(t *testing.T) {
+	err := fmt.Errorf("read config: %w", fs.ErrNotExist)
+	tests := []struct {
+		name          string
+		log           func(Logger)
+		wantType      string
+		wantMessage   string
+		wantCauses    []string
+		wantStatusMsg string
+	}{
+		{
+			name:          "warn with error",
+			log:           func(l Logger) { l.Warn("could not read", "error", err) },
+			wantType:      "*fmt.wrapError",
+			wantMessage:   err.Error(),
+			wantCauses:    []string{fs.ErrNotExist.Error()},
+			wantStatusMsg: err.Error(),
+		},
+		{
+			name:          "error without error",
+			log:           func(l Logger) { l.Error("gave up") },
+			wantType:      "log",
+			wantMessage:   "gave up",
+			wantStatusMsg: "gave up",
+		},
+	}
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				c, _ := fileConfig(t, backend)
+				setTestConfig(t, c)
+				ctx, span, rec := startSpan(t)
+
+				tt.log(New(ctx))
+				span.End()
+
+				s := rec.Ended()[0]
+				events := eventsNamed(s, "exception")
+				if len(events) != 1 {
+					t.Fatalf("got %d exception events, want 1", len(events))
+				}
+				typ, _ := eventAttr(events[0], "exception.type")
+				msg, _ := eventAttr(events[0], "exception.message")
+				causes, _ := eventAttr(events[0], string(exceptionCauseMessageKey))
+				if typ.AsString() != tt.wantType || msg.AsString() != tt.wantMessage {
+					t.Errorf("exception = (%s, %s), want (%s, %s)", typ.AsString(), msg.AsString(), tt.wantType, tt.wantMessage)
+				}
+				if !reflect.DeepEqual(causes.AsStringSlice(), tt.wantCauses) {
+					t.Errorf("exception causes = %v, want %v", causes.AsStringSlice(), tt.wantCauses)
+				}
+				if s.Status().Code != codes.Error || s.Status().Description != tt.wantStatusMsg {
+					t.Errorf("span status = %+v, want an error with %q", s.Status(), tt.wantStatusMsg)
+				}
+			})
+		}
+	}
+
+	t.Run("info without error", func(t *testing.T) {
+		c, _ := fileConfig(t, BackendLogrus)
+		setTestConfig(t, c)
+		ctx, span, rec := startSpan(t)
+		New(ctx).Info("fine")
+		span.End()
+		if n := len(eventsNamed(rec.Ended()[0], "exception")); n != 0 {
+			t.Errorf("got %d exception events, want 0", n)
+		}
+	})
+}
+
+func TestLogNilPointerError(t *testing.T) {
+	var nilErr *fs.PathError
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c, output := fileConfig(t, backend)
+			setTestConfig(t, c)
+			ctx, span, rec := startSpan(t)
+
+			New(ctx).Error("open config", "error", nilErr)
+			span.End()
+
+			if got := readFile(t, output); !strings.Contains(got, "open config") {
+				t.Errorf("output = %s", got)
+			}
+			// The nil error is not an exception of its own.
+			events := eventsNamed(rec.Ended()[0], "exception")
+			if len(events) != 1 {
+				t.Fatalf("got %d exception events, want 1", len(events))
+			}
+			if v, _ := eventAttr(events[0], "exception.type"); v.AsString() != "log" {
+				t.Errorf("exception.type = %s, want log", v.AsString())
+			}
+		})
+	}
+}
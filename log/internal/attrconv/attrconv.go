@@ -0,0 +1,247 @@
+// Package attrconv converts arbitrary Go values, like those found in log fields, into OpenTelemetry attributes.
+package attrconv
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Options controls how values are converted.
+type Options struct {
+	// MaxDepth is how deep maps, structs & pointers are flattened into dotted keys.
+	// Values nested deeper than that are encoded as a json string.
+	MaxDepth int
+	// MaxStringLen is the maximum length, in bytes, of string values. Longer strings are truncated.
+	// Zero means no limit.
+	MaxStringLen int
+}
+
+// DefaultOptions are the options used by Append.
+var DefaultOptions = Options{MaxDepth: 3, MaxStringLen: 4096}
+
+// Append converts key & value into attributes, using DefaultOptions, and appends them to attrs.
+func Append(attrs []attribute.KeyValue, key string, value any) []attribute.KeyValue {
+	return DefaultOptions.Append(attrs, key, value)
+}
+
+// Append converts key & value into attributes and appends them to attrs.
+//
+// Scalars become a single attribute, slices of scalars become a slice attribute
+// and maps & structs are flattened into one attribute per field, with dotted keys; eg `user.address.city`.
+func (o Options) Append(attrs []attribute.KeyValue, key string, value any) []attribute.KeyValue {
+	return o.appendValue(attrs, key, value, 0)
+}
+
+func (o Options) appendValue(attrs []attribute.KeyValue, key string, value any, depth int) []attribute.KeyValue {
+	switch v := value.(type) {
+	case nil:
+		return append(attrs, attribute.String(key, "<nil>"))
+	case string:
+		return append(attrs, attribute.String(key, o.truncate(v)))
+	case bool:
+		return append(attrs, attribute.Bool(key, v))
+	case int:
+		return append(attrs, attribute.Int(key, v))
+	case int8:
+		return append(attrs, attribute.Int64(key, int64(v)))
+	case int16:
+		return append(attrs, attribute.Int64(key, int64(v)))
+	case int32:
+		return append(attrs, attribute.Int64(key, int64(v)))
+	case int64:
+		return append(attrs, attribute.Int64(key, v))
+	case uint8:
+		return append(attrs, attribute.Int64(key, int64(v)))
+	case uint16:
+		return append(attrs, attribute.Int64(key, int64(v)))
+	case uint32:
+		return append(attrs, attribute.Int64(key, int64(v)))
+	case uint:
+		return append(attrs, uintAttr(key, uint64(v)))
+	case uint64:
+		return append(attrs, uintAttr(key, v))
+	case uintptr:
+		return append(attrs, uintAttr(key, uint64(v)))
+	case float32:
+		return append(attrs, attribute.Float64(key, float64(v)))
+	case float64:
+		return append(attrs, attribute.Float64(key, v))
+	case time.Time:
+		return append(attrs, attribute.String(key, v.Format(time.RFC3339Nano)))
+	case time.Duration:
+		return append(attrs, attribute.String(key, v.String()))
+	case []byte:
+		return append(attrs, attribute.String(key, o.truncate(string(v))))
+	case error:
+		if IsNilPointer(v) {
+			return append(attrs, attribute.String(key, "<nil>"))
+		}
+		return append(attrs, attribute.String(key, o.truncate(v.Error())))
+	case fmt.Stringer:
+		if IsNilPointer(v) {
+			return append(attrs, attribute.String(key, "<nil>"))
+		}
+		return append(attrs, attribute.String(key, o.truncate(v.String())))
+	case attribute.Value:
+		return append(attrs, attribute.KeyValue{Key: attribute.Key(key), Value: v})
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return append(attrs, attribute.Bool(key, rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return append(attrs, attribute.Int64(key, rv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return append(attrs, uintAttr(key, rv.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return append(attrs, attribute.Float64(key, rv.Float()))
+	case reflect.String:
+		return append(attrs, attribute.String(key, o.truncate(rv.String())))
+	case reflect.Slice, reflect.Array:
+		if kv, ok := o.sliceAttr(key, rv); ok {
+			return append(attrs, kv)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return append(attrs, attribute.String(key, "<nil>"))
+		}
+		if depth < o.MaxDepth {
+			return o.appendValue(attrs, key, rv.Elem().Interface(), depth+1)
+		}
+	case reflect.Map:
+		if depth < o.MaxDepth && rv.Len() > 0 {
+			keys := rv.MapKeys()
+			names := make([]string, len(keys))
+			byName := make(map[string]reflect.Value, len(keys))
+			for i, k := range keys {
+				names[i] = fmt.Sprint(k.Interface())
+				byName[names[i]] = rv.MapIndex(k)
+			}
+			sort.Strings(names)
+			for _, n := range names {
+				attrs = o.appendValue(attrs, key+"."+n, byName[n].Interface(), depth+1)
+			}
+			return attrs
+		}
+	case reflect.Struct:
+		if depth < o.MaxDepth && rv.NumField() > 0 {
+			n := len(attrs)
+			t := rv.Type()
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				if !f.IsExported() {
+					continue
+				}
+				name := f.Name
+				if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+					continue
+				} else if tag != "" {
+					name = tag
+				}
+				attrs = o.appendValue(attrs, key+"."+name, rv.Field(i).Interface(), depth+1)
+			}
+			if len(attrs) > n {
+				return attrs
+			}
+			// None of the fields could be flattened; eg, they are all unexported.
+		}
+	}
+
+	// A struct whose fields are all unexported, or ignored, is encoded by json as `{}`; fmt shows its fields.
+	if b, err := json.Marshal(value); err == nil && (rv.Kind() != reflect.Struct || string(b) != "{}") {
+		return append(attrs, attribute.String(key, o.truncate(string(b))))
+	}
+	return append(attrs, attribute.String(key, o.truncate(fmt.Sprint(value))))
+}
+
+// sliceAttr converts slices & arrays of scalars into slice attributes.
+func (o Options) sliceAttr(key string, rv reflect.Value) (attribute.KeyValue, bool) {
+	n := rv.Len()
+	switch rv.Type().Elem().Kind() {
+	case reflect.Bool:
+		s := make([]bool, n)
+		for i := range s {
+			s[i] = rv.Index(i).Bool()
+		}
+		return attribute.BoolSlice(key, s), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s := make([]int64, n)
+		for i := range s {
+			s[i] = rv.Index(i).Int()
+		}
+		return attribute.Int64Slice(key, s), true
+	case reflect.Uint8:
+		// []byte is handled by appendValue, this is for named byte slices & arrays.
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(rv.Index(i).Uint())
+		}
+		return attribute.String(key, o.truncate(string(b))), true
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s := make([]int64, n)
+		for i := range s {
+			u := rv.Index(i).Uint()
+			if u > math.MaxInt64 {
+				// does not fit; fall back to strings for the whole slice.
+				ss := make([]string, n)
+				for j := range ss {
+					ss[j] = strconv.FormatUint(rv.Index(j).Uint(), 10)
+				}
+				return attribute.StringSlice(key, ss), true
+			}
+			s[i] = int64(u)
+		}
+		return attribute.Int64Slice(key, s), true
+	case reflect.Float32, reflect.Float64:
+		s := make([]float64, n)
+		for i := range s {
+			s[i] = rv.Index(i).Float()
+		}
+		return attribute.Float64Slice(key, s), true
+	case reflect.String:
+		s := make([]string, n)
+		for i := range s {
+			s[i] = o.truncate(rv.Index(i).String())
+		}
+		return attribute.StringSlice(key, s), true
+	default:
+		return attribute.KeyValue{}, false
+	}
+}
+
+// uintAttr converts u into an int64 attribute, or a string one if it would overflow an int64.
+func uintAttr(key string, u uint64) attribute.KeyValue {
+	if u > math.MaxInt64 {
+		return attribute.String(key, strconv.FormatUint(u, 10))
+	}
+	return attribute.Int64(key, int64(u))
+}
+
+// truncate cuts s to at most MaxStringLen bytes, without splitting a utf8 character.
+func (o Options) truncate(s string) string {
+	if o.MaxStringLen <= 0 || len(s) <= o.MaxStringLen {
+		return s
+	}
+	i := o.MaxStringLen
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i]
+}
+
+// IsNilPointer reports whether v is a nil pointer; eg, a nil *os.PathError passed as an error.
+// Calling the methods of such a value, like Error or String, usually panics.
+func IsNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
@@ -0,0 +1,148 @@
+package attrconv
+
+import (
+	"errors"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type stringer struct{ s string }
+
+func (s *stringer) String() string { return s.s }
+
+type address struct {
+	City    string `json:"city"`
+	Country string `json:"country,omitempty"`
+	Secret  string `json:"-"`
+	zip     string
+}
+
+type user struct {
+	Name    string
+	Address address `json:"address"`
+	Err     error
+}
+
+type opaque struct {
+	a int
+	b string
+}
+
+type level int
+
+type nested struct {
+	A struct {
+		B struct {
+			C struct{ D int }
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	var (
+		nilPtr      *address
+		nilStringer *stringer
+		nilErr      error
+		nilPathErr  *os.PathError
+	)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	tests := []struct {
+		name  string
+		opts  Options
+		value any
+		want  []attribute.KeyValue
+	}{
+		// scalars
+		{"string", DefaultOptions, "x", []attribute.KeyValue{attribute.String("k", "x")}},
+		{"bool", DefaultOptions, true, []attribute.KeyValue{attribute.Bool("k", true)}},
+		{"int8", DefaultOptions, int8(-3), []attribute.KeyValue{attribute.Int64("k", -3)}},
+		{"float32", DefaultOptions, float32(1.5), []attribute.KeyValue{attribute.Float64("k", 1.5)}},
+		{"named int", DefaultOptions, level(4), []attribute.KeyValue{attribute.Int64("k", 4)}},
+		{"bytes", DefaultOptions, []byte("hi"), []attribute.KeyValue{attribute.String("k", "hi")}},
+		{"error", DefaultOptions, errors.New("boom"), []attribute.KeyValue{attribute.String("k", "boom")}},
+		{"stringer", DefaultOptions, &stringer{"s"}, []attribute.KeyValue{attribute.String("k", "s")}},
+		{"attribute.Value", DefaultOptions, attribute.IntValue(9), []attribute.KeyValue{attribute.Int("k", 9)}},
+
+		// uint64 overflow
+		{"uint64", DefaultOptions, uint64(7), []attribute.KeyValue{attribute.Int64("k", 7)}},
+		{"uint64 max int64", DefaultOptions, uint64(math.MaxInt64), []attribute.KeyValue{attribute.Int64("k", math.MaxInt64)}},
+		{"uint64 overflow", DefaultOptions, uint64(math.MaxUint64), []attribute.KeyValue{attribute.String("k", "18446744073709551615")}},
+		{"uint overflow", DefaultOptions, uint(math.MaxUint64), []attribute.KeyValue{attribute.String("k", "18446744073709551615")}},
+		{"uint64 slice", DefaultOptions, []uint64{1, 2}, []attribute.KeyValue{attribute.Int64Slice("k", []int64{1, 2})}},
+		{"mixed uint64 slice", DefaultOptions, []uint64{1, math.MaxUint64}, []attribute.KeyValue{attribute.StringSlice("k", []string{"1", "18446744073709551615"})}},
+
+		// slices
+		{"string slice", DefaultOptions, []string{"a", "b"}, []attribute.KeyValue{attribute.StringSlice("k", []string{"a", "b"})}},
+		{"int array", DefaultOptions, [2]int{1, 2}, []attribute.KeyValue{attribute.Int64Slice("k", []int64{1, 2})}},
+		{"float slice", DefaultOptions, []float32{0.5}, []attribute.KeyValue{attribute.Float64Slice("k", []float64{0.5})}},
+		{"bool slice", DefaultOptions, []bool{true}, []attribute.KeyValue{attribute.BoolSlice("k", []bool{true})}},
+		{"struct slice", DefaultOptions, []address{{City: "x"}}, []attribute.KeyValue{attribute.String("k", `[{"city":"x"}]`)}},
+		{"any slice", DefaultOptions, []any{1, "a"}, []attribute.KeyValue{attribute.String("k", `[1,"a"]`)}},
+
+		// time
+		{"time", DefaultOptions, ts, []attribute.KeyValue{attribute.String("k", "2024-01-02T03:04:05.000000006Z")}},
+		{"duration", DefaultOptions, 1500 * time.Millisecond, []attribute.KeyValue{attribute.String("k", "1.5s")}},
+
+		// maps & structs
+		{"map", DefaultOptions, map[string]any{"b": 1, "a": "x"}, []attribute.KeyValue{attribute.String("k.a", "x"), attribute.Int("k.b", 1)}},
+		{"int keyed map", DefaultOptions, map[int]string{2: "b", 1: "a"}, []attribute.KeyValue{attribute.String("k.1", "a"), attribute.String("k.2", "b")}},
+		{"empty map", DefaultOptions, map[string]int{}, []attribute.KeyValue{attribute.String("k", "{}")}},
+		{
+			"struct", DefaultOptions,
+			user{Name: "jane", Address: address{City: "Nairobi", Secret: "s", zip: "00100"}},
+			[]attribute.KeyValue{
+				attribute.String("k.Name", "jane"),
+				attribute.String("k.address.city", "Nairobi"),
+				attribute.String("k.address.country", ""),
+				attribute.String("k.Err", "<nil>"),
+			},
+		},
+		{"pointer to struct", DefaultOptions, &address{City: "x"}, []attribute.KeyValue{attribute.String("k.city", "x"), attribute.String("k.country", "")}},
+		{"unexported fields", DefaultOptions, opaque{a: 1, b: "x"}, []attribute.KeyValue{attribute.String("k", "{1 x}")}},
+		{"ignored fields", DefaultOptions, struct {
+			A int `json:"-"`
+		}{1}, []attribute.KeyValue{attribute.String("k", "{1}")}},
+
+		// depth
+		{"max depth", Options{MaxDepth: 2}, nested{}, []attribute.KeyValue{attribute.String("k.A.B", `{"C":{"D":0}}`)}},
+		{"zero max depth", Options{}, address{City: "x"}, []attribute.KeyValue{attribute.String("k", `{"city":"x"}`)}},
+		{"deep enough", Options{MaxDepth: 4}, nested{}, []attribute.KeyValue{attribute.Int64("k.A.B.C.D", 0)}},
+
+		// truncation
+		{"truncate", Options{MaxStringLen: 3}, "abcdef", []attribute.KeyValue{attribute.String("k", "abc")}},
+		{"truncate utf8", Options{MaxStringLen: 4}, "日本語", []attribute.KeyValue{attribute.String("k", "日")}},
+		{"truncate slice", Options{MaxStringLen: 2}, []string{"abc", "d"}, []attribute.KeyValue{attribute.StringSlice("k", []string{"ab", "d"})}},
+		{"no truncation", Options{}, "abcdef", []attribute.KeyValue{attribute.String("k", "abcdef")}},
+
+		// nils
+		{"nil", DefaultOptions, nil, []attribute.KeyValue{attribute.String("k", "<nil>")}},
+		{"nil pointer", DefaultOptions, nilPtr, []attribute.KeyValue{attribute.String("k", "<nil>")}},
+		{"nil stringer", DefaultOptions, nilStringer, []attribute.KeyValue{attribute.String("k", "<nil>")}},
+		{"nil interface", DefaultOptions, nilErr, []attribute.KeyValue{attribute.String("k", "<nil>")}},
+		{"nil error pointer", DefaultOptions, error(nilPathErr), []attribute.KeyValue{attribute.String("k", "<nil>")}},
+		{"nil slice", DefaultOptions, []string(nil), []attribute.KeyValue{attribute.StringSlice("k", []string{})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.opts.Append(nil, "k", tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Append() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendKeepsAttrs(t *testing.T) {
+	attrs := []attribute.KeyValue{attribute.String("first", "x")}
+	got := Append(attrs, "k", 1)
+	want := []attribute.KeyValue{attribute.String("first", "x"), attribute.Int("k", 1)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Append() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Level is the logging level that is applied to all the logging backends(logrus, zerolog & slog).
+type Level int8
+
+const (
+	TraceLevel Level = iota
+	DebugLevel
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case TraceLevel:
+		return "trace"
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
+	default:
+		return fmt.Sprintf("Level(%d)", l)
+	}
+}
+
+// SeverityText is the name of the level as used in the OTel logs data model.
+// It is the level vocabulary that all three logging backends use.
+// See: https://opentelemetry.io/docs/specs/otel/logs/data-model/#displaying-severity
+func (l Level) SeverityText() string {
+	return strings.ToUpper(l.String())
+}
+
+// SeverityNumber is the number of the level as used in the OTel logs data model.
+// See: https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-severitynumber
+func (l Level) SeverityNumber() int {
+	switch l {
+	case TraceLevel:
+		return 1
+	case DebugLevel:
+		return 5
+	case InfoLevel:
+		return 9
+	case WarnLevel:
+		return 13
+	case ErrorLevel:
+		return 17
+	default:
+		return 21
+	}
+}
+
+// ParseLevel converts a level name into a Level.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "trace":
+		return TraceLevel, nil
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	default:
+		return 0, fmt.Errorf("log: unknown level %q", s)
+	}
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	lvl, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*l = lvl
+	return nil
+}
+
+func levelFromLogrus(lvl logrus.Level) Level {
+	switch lvl {
+	case logrus.TraceLevel:
+		return TraceLevel
+	case logrus.DebugLevel:
+		return DebugLevel
+	case logrus.InfoLevel:
+		return InfoLevel
+	case logrus.WarnLevel:
+		return WarnLevel
+	case logrus.ErrorLevel:
+		return ErrorLevel
+	default:
+		return FatalLevel
+	}
+}
+
+func levelFromZerolog(lvl zerolog.Level) Level {
+	switch {
+	case lvl <= zerolog.TraceLevel:
+		return TraceLevel
+	case lvl == zerolog.DebugLevel:
+		return DebugLevel
+	case lvl == zerolog.InfoLevel:
+		return InfoLevel
+	case lvl == zerolog.WarnLevel:
+		return WarnLevel
+	case lvl == zerolog.ErrorLevel:
+		return ErrorLevel
+	default:
+		return FatalLevel
+	}
+}
+
+// slogLevelFatal is above slog.LevelError, since slog has no fatal level.
+const slogLevelFatal = slog.LevelError + 4
+
+func levelFromSlog(lvl slog.Level) Level {
+	switch {
+	case lvl < slog.LevelDebug:
+		return TraceLevel
+	case lvl < slog.LevelInfo:
+		return DebugLevel
+	case lvl < slog.LevelWarn:
+		return InfoLevel
+	case lvl < slog.LevelError:
+		return WarnLevel
+	case lvl < slogLevelFatal:
+		return ErrorLevel
+	default:
+		return FatalLevel
+	}
+}
+
+var (
+	severityTextKey   = attribute.Key("severity_text")
+	severityNumberKey = attribute.Key("severity_number")
+	bodyKey           = attribute.Key("body")
+)
+
+// logRecordAttrs returns the attributes of a log-derived span event that come from the OTel logs data model;
+// SeverityText, SeverityNumber, Body, the `code.*` attributes of the caller(if known) & the Resource; see SetResource.
+// See: https://opentelemetry.io/docs/specs/otel/logs/data-model/
+func logRecordAttrs(lvl Level, msg string, caller *runtime.Frame, extra int) []attribute.KeyValue {
+	res := getResourceAttrs()
+	attrs := make([]attribute.KeyValue, 0, 6+len(res)+extra)
+	attrs = append(attrs,
+		severityTextKey.String(lvl.SeverityText()),
+		severityNumberKey.Int(lvl.SeverityNumber()),
+		bodyKey.String(msg),
+	)
+
+	if caller != nil {
+		if caller.Function != "" {
+			attrs = append(attrs, semconv.CodeFunctionKey.String(caller.Function))
+		}
+		if caller.File != "" {
+			attrs = append(attrs, semconv.CodeFilepathKey.String(caller.File))
+			attrs = append(attrs, semconv.CodeLineNumberKey.Int(caller.Line))
+		}
+	}
+
+	return append(attrs, res...)
+}
+
+type levelCtxKey struct{}
+
+// ContextWithLevel returns a context whose logs are made at lvl & above, even if the configured Level is higher.
+// This enables, say, debug logs for just one request; the Level of all other logs is unchanged.
+// It cannot be used to raise the configured Level.
+func ContextWithLevel(ctx context.Context, lvl Level) context.Context {
+	return context.WithValue(ctx, levelCtxKey{}, lvl)
+}
+
+// contextLevel returns the level of logs made with ctx; the lower of configured & the one set by ContextWithLevel.
+// It reports false if ctx does not lower the configured level.
+func contextLevel(ctx context.Context, configured Level) (Level, bool) {
+	if ctx == nil {
+		return configured, false
+	}
+	lvl, ok := ctx.Value(levelCtxKey{}).(Level)
+	if !ok || lvl >= configured {
+		return configured, false
+	}
+	return lvl, true
+}
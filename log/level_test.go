@@ -0,0 +1,104 @@
+package log
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		lvl            Level
+		text           string
+		severityText   string
+		severityNumber int
+	}{
+		{TraceLevel, "trace", "TRACE", 1},
+		{DebugLevel, "debug", "DEBUG", 5},
+		{InfoLevel, "info", "INFO", 9},
+		{WarnLevel, "warn", "WARN", 13},
+		{ErrorLevel, "error", "ERROR", 17},
+		{FatalLevel, "fatal", "FATAL", 21},
+	}
+	for _, tt := range tests {
+		if got := tt.lvl.SeverityText(); got != tt.severityText {
+			t.Errorf("%v.SeverityText() = %s, want %s", tt.lvl, got, tt.severityText)
+		}
+		if got := tt.lvl.SeverityNumber(); got != tt.severityNumber {
+			t.Errorf("%v.SeverityNumber() = %d, want %d", tt.lvl, got, tt.severityNumber)
+		}
+		for _, s := range []string{tt.text, tt.severityText} {
+			if got, err := ParseLevel(s); err != nil || got != tt.lvl {
+				t.Errorf("ParseLevel(%q) = %v, %v; want %v", s, got, err, tt.lvl)
+			}
+		}
+
+		// Each backend round trips the level.
+		if got := levelFromLogrus(logrusLevel(tt.lvl)); got != tt.lvl {
+			t.Errorf("logrus: %v round trips to %v", tt.lvl, got)
+		}
+		if got := levelFromZerolog(zerologLevel(tt.lvl)); got != tt.lvl {
+			t.Errorf("zerolog: %v round trips to %v", tt.lvl, got)
+		}
+		if got := levelFromSlog(slogLevel(tt.lvl)); got != tt.lvl {
+			t.Errorf("slog: %v round trips to %v", tt.lvl, got)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) expected an error")
+	}
+	if got := levelFromSlog(slog.LevelInfo + 1); got != InfoLevel {
+		t.Errorf("levelFromSlog(INFO+1) = %v, want %v", got, InfoLevel)
+	}
+	if got := levelFromZerolog(zerolog.PanicLevel); got != FatalLevel {
+		t.Errorf("levelFromZerolog(panic) = %v, want %v", got, FatalLevel)
+	}
+	if got := levelFromLogrus(logrus.PanicLevel); got != FatalLevel {
+		t.Errorf("levelFromLogrus(panic) = %v, want %v", got, FatalLevel)
+	}
+}
+
+func TestLogEventAttributes(t *testing.T) {
+	for _, backend := range backends {
+		for _, caller := range []bool{true, false} {
+			c, output := fileConfig(t, backend)
+			c.Caller = caller
+			setTestConfig(t, c)
+			ctx, span, rec := startSpan(t)
+
+			New(ctx).Warn("disk is almost full", "used", 0.93)
+			span.End()
+
+			events := eventsNamed(rec.Ended()[0], "log")
+			if len(events) != 1 {
+				t.Fatalf("%s: got %d log events, want 1", backend, len(events))
+			}
+			e := events[0]
+			if v, _ := eventAttr(e, "severity_text"); v.AsString() != "WARN" {
+				t.Errorf("%s: severity_text = %q, want WARN", backend, v.AsString())
+			}
+			if v, _ := eventAttr(e, "severity_number"); v.AsInt64() != 13 {
+				t.Errorf("%s: severity_number = %d, want 13", backend, v.AsInt64())
+			}
+			if v, _ := eventAttr(e, "body"); v.AsString() != "disk is almost full" {
+				t.Errorf("%s: body = %q", backend, v.AsString())
+			}
+			if v, _ := eventAttr(e, "used"); v.AsFloat64() != 0.93 {
+				t.Errorf("%s: used = %v, want 0.93", backend, v.AsFloat64())
+			}
+			_, hasFile := eventAttr(e, "code.filepath")
+			_, hasLine := eventAttr(e, "code.lineno")
+			if hasFile != caller || hasLine != caller {
+				t.Errorf("%s: code.filepath = %v & code.lineno = %v, with caller %v", backend, hasFile, hasLine, caller)
+			}
+
+			if got := readFile(t, output); !strings.Contains(got, `"WARN"`) {
+				t.Errorf("%s: log does not use the WARN severity text: %s", backend, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is a backend agnostic logger.
+// The backend(logrus, zerolog or slog) that does the actual logging is selected by Config.Backend
+//
+// The kv arguments are alternating key-value pairs, like in slog.
+//
+// usage:
+//
+//	ctx, span := tracer.Start(ctx, "myFuncName")
+//	l := New(ctx)
+//	l.Info("hello world", "age", 56)
+type Logger interface {
+	Trace(msg string, kv ...any)
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+	// With returns a Logger that adds kv to all its logs.
+	With(kv ...any) Logger
+	// WithContext returns a Logger whose logs are correlated with the span in ctx.
+	WithContext(ctx context.Context) Logger
+}
+
+const (
+	BackendLogrus  = "logrus"
+	BackendZerolog = "zerolog"
+	BackendSlog    = "slog"
+)
+
+// New returns a Logger that uses the currently configured backend.
+func New(ctx context.Context) Logger {
+	mu.RLock()
+	backend := cfg.Backend
+	mu.RUnlock()
+
+	switch backend {
+	case BackendZerolog:
+		return zerologAdapter{l: NewZerolog(ctx)}
+	case BackendSlog:
+		return slogAdapter{l: NewSlog(ctx), ctx: ctx}
+	default:
+		return logrusAdapter{e: NewLogrus(ctx)}
+	}
+}
+
+type logrusAdapter struct{ e *logrus.Entry }
+
+func (a logrusAdapter) Trace(msg string, kv ...any) { a.log(logrus.TraceLevel, msg, kv) }
+func (a logrusAdapter) Debug(msg string, kv ...any) { a.log(logrus.DebugLevel, msg, kv) }
+func (a logrusAdapter) Info(msg string, kv ...any)  { a.log(logrus.InfoLevel, msg, kv) }
+func (a logrusAdapter) Warn(msg string, kv ...any)  { a.log(logrus.WarnLevel, msg, kv) }
+func (a logrusAdapter) Error(msg string, kv ...any) { a.log(logrus.ErrorLevel, msg, kv) }
+
+func (a logrusAdapter) With(kv ...any) Logger {
+	return logrusAdapter{e: a.e.WithFields(logrus.Fields(kvToMap(kv)))}
+}
+
+func (a logrusAdapter) WithContext(ctx context.Context) Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	if lvl, ok := contextLevel(ctx, cfg.Level); ok {
+		return logrusAdapter{e: newLogrus(cfg, out, lvl).WithFields(a.e.Data).WithContext(ctx)}
+	}
+	return logrusAdapter{e: a.e.WithContext(ctx)}
+}
+
+func (a logrusAdapter) log(lvl logrus.Level, msg string, kv []any) {
+	if !a.e.Logger.IsLevelEnabled(lvl) {
+		return
+	}
+	// The caller reported by logrus is fixed up by logrusTraceHook.
+	a.e.WithFields(logrus.Fields(kvToMap(kv))).Log(lvl, msg)
+}
+
+type zerologAdapter struct {
+	l zerolog.Logger
+	// fields are those added via With. zerolog cannot read back the fields of a logger,
+	// so they are kept in order to rebuild the logger in WithContext.
+	fields map[string]any
+}
+
+func (a zerologAdapter) Trace(msg string, kv ...any) { a.log(a.l.Trace(), msg, kv) }
+func (a zerologAdapter) Debug(msg string, kv ...any) { a.log(a.l.Debug(), msg, kv) }
+func (a zerologAdapter) Info(msg string, kv ...any)  { a.log(a.l.Info(), msg, kv) }
+func (a zerologAdapter) Warn(msg string, kv ...any)  { a.log(a.l.Warn(), msg, kv) }
+func (a zerologAdapter) Error(msg string, kv ...any) { a.log(a.l.Error(), msg, kv) }
+
+func (a zerologAdapter) With(kv ...any) Logger {
+	added := kvToMap(kv)
+	fields := make(map[string]any, len(a.fields)+len(added))
+	for k, v := range a.fields {
+		fields[k] = v
+	}
+	for k, v := range added {
+		fields[k] = v
+	}
+	return zerologAdapter{l: a.l.With().Fields(added).Logger(), fields: fields}
+}
+
+func (a zerologAdapter) WithContext(ctx context.Context) Logger {
+	// a.l already has the trace hook of its own context; hooks cannot be removed, so the logger is rebuilt.
+	l := NewZerolog(ctx)
+	if len(a.fields) > 0 {
+		l = l.With().Fields(a.fields).Logger()
+	}
+	return zerologAdapter{l: l, fields: a.fields}
+}
+
+func (a zerologAdapter) log(e *zerolog.Event, msg string, kv []any) {
+	if e == nil {
+		return
+	}
+	fields := kvToMap(kv)
+	mu.RLock()
+	normalized := cfg.Schema == SchemaNormalized
+	mu.RUnlock()
+	if normalized {
+		for k, v := range fields {
+			if isNormalizedKey(k) {
+				delete(fields, k)
+				fields["fields."+k] = v
+			}
+		}
+	}
+	if len(fields) > 0 {
+		e = e.Ctx(contextWithLogFields(e.GetCtx(), fields))
+	}
+	// The caller reported by zerolog is fixed up by zerologCallerMarshal.
+	e.Fields(fields).Msg(msg)
+}
+
+type slogAdapter struct {
+	l   *slog.Logger
+	ctx context.Context
+	// kv are the key-values added via With; they are kept in order to rebuild the logger in WithContext.
+	kv []any
+}
+
+func (a slogAdapter) Trace(msg string, kv ...any) { a.log(slogLevelTrace, msg, kv) }
+func (a slogAdapter) Debug(msg string, kv ...any) { a.log(slog.LevelDebug, msg, kv) }
+func (a slogAdapter) Info(msg string, kv ...any)  { a.log(slog.LevelInfo, msg, kv) }
+func (a slogAdapter) Warn(msg string, kv ...any)  { a.log(slog.LevelWarn, msg, kv) }
+func (a slogAdapter) Error(msg string, kv ...any) { a.log(slog.LevelError, msg, kv) }
+
+func (a slogAdapter) With(kv ...any) Logger {
+	return slogAdapter{l: a.l.With(kv...), ctx: a.ctx, kv: append(a.kv[:len(a.kv):len(a.kv)], kv...)}
+}
+
+func (a slogAdapter) WithContext(ctx context.Context) Logger {
+	l := NewSlog(ctx)
+	if len(a.kv) > 0 {
+		l = l.With(a.kv...)
+	}
+	return slogAdapter{l: l, ctx: ctx, kv: a.kv}
+}
+
+func (a slogAdapter) log(lvl slog.Level, msg string, kv []any) {
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	h := a.l.Handler()
+	if !h.Enabled(ctx, lvl) {
+		return
+	}
+
+	// See: https://pkg.go.dev/log/slog#example-package-Wrapping
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip [Callers, log, Info]
+	r := slog.NewRecord(time.Now(), lvl, msg, pcs[0])
+	r.Add(kv...)
+	_ = h.Handle(ctx, r)
+}
+
+// kvToMap converts alternating key-value pairs into a map.
+// Like slog, a key that is not a string is reported under the `!BADKEY` key.
+func kvToMap(kv []any) map[string]any {
+	m := make(map[string]any, len(kv)/2)
+	for len(kv) > 0 {
+		switch k := kv[0].(type) {
+		case string:
+			if len(kv) == 1 {
+				m["!BADKEY"] = k
+				kv = kv[1:]
+				continue
+			}
+			m[k] = kv[1]
+			kv = kv[2:]
+		case slog.Attr:
+			m[k.Key] = k.Value.Any()
+			kv = kv[1:]
+		default:
+			m["!BADKEY"] = fmt.Sprint(k)
+			kv = kv[1:]
+		}
+	}
+	return m
+}
+
+// pkgPath is the import path of this package.
+var pkgPath = reflect.TypeOf(Config{}).PkgPath()
+
+// callerFrame returns the first frame of the call stack that is outside of this package and the logging backends.
+func callerFrame() (runtime.Frame, bool) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !isLoggingFrame(f.Function) {
+			return f, true
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// loggingPackages are the packages whose frames are skipped when reporting the caller of a log.
+// The OTel SDK logs via otel.Handle & its internal/global package; see ErrorHandler & NewLogr.
+var loggingPackages = []string{
+	pkgPath + ".",
+	"github.com/sirupsen/logrus.",
+	"github.com/rs/zerolog.",
+	"log/slog.",
+	"github.com/go-logr/logr.",
+	"go.opentelemetry.io/otel.",
+	"go.opentelemetry.io/otel/internal/global.",
+}
+
+func isLoggingFrame(function string) bool {
+	for _, p := range loggingPackages {
+		if strings.HasPrefix(function, p) {
+			return true
+		}
+	}
+	return false
+}
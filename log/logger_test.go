@@ -0,0 +1,182 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metricReader collects the metrics recorded by this package; see countLog & countSDKError.
+var metricReader = sdkmetric.NewManualReader()
+
+func TestMain(m *testing.M) {
+	// The counters are created on first use, so the MeterProvider is set before any test logs.
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metricReader)))
+	os.Exit(m.Run())
+}
+
+// startSpan starts a recording span, whose ended spans are in the returned recorder.
+func startSpan(t *testing.T) (context.Context, trace.Span, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(SpanProcessor()),
+		sdktrace.WithSpanProcessor(rec),
+	)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	ctx, span := tp.Tracer("test").Start(context.Background(), t.Name())
+	return ctx, span, rec
+}
+
+// eventsNamed returns the events of s that are named name.
+func eventsNamed(s sdktrace.ReadOnlySpan, name string) []sdktrace.Event {
+	var events []sdktrace.Event
+	for _, e := range s.Events() {
+		if e.Name == name {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// eventAttr returns the value of the attribute key of e.
+func eventAttr(e sdktrace.Event, key string) (attribute.Value, bool) {
+	for _, kv := range e.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// counterValue returns the sum of the data points of the int64 counter name, whose attributes include attrs.
+func counterValue(t *testing.T, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := metricReader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if m.Name != name || !ok {
+				continue
+			}
+		points:
+			for _, dp := range sum.DataPoints {
+				for _, kv := range attrs {
+					if v, ok := dp.Attributes.Value(kv.Key); !ok || v != kv.Value {
+						continue points
+					}
+				}
+				total += dp.Value
+			}
+		}
+	}
+	return total
+}
+
+var backends = []string{BackendLogrus, BackendZerolog, BackendSlog}
+
+func TestNewUsesBackend(t *testing.T) {
+	tests := map[string]any{
+		BackendLogrus:  logrusAdapter{},
+		BackendZerolog: zerologAdapter{},
+		BackendSlog:    slogAdapter{},
+	}
+	for backend, want := range tests {
+		c, _ := fileConfig(t, backend)
+		setTestConfig(t, c)
+		if got := New(context.Background()); reflect.TypeOf(got) != reflect.TypeOf(want) {
+			t.Errorf("New() with backend %s = %T, want %T", backend, got, want)
+		}
+	}
+}
+
+func TestLoggerWithContext(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c, output := fileConfig(t, backend)
+			setTestConfig(t, c)
+			ctx, span, rec := startSpan(t)
+			severity := logSeverityKey.String(InfoLevel.SeverityText())
+			before := counterValue(t, "log.records", logBackendKey.String(backend), severity)
+
+			New(ctx).With("user", "jane").WithContext(ctx).With("order", 7).WithContext(ctx).Info("hello")
+			span.End()
+
+			got := readFile(t, output)
+			if n := strings.Count(got, `"traceId"`); n != 1 {
+				t.Errorf("traceId appears %d times, want 1: %s", n, got)
+			}
+			for _, want := range []string{`"user":"jane"`, `"order":7`} {
+				if !strings.Contains(got, want) {
+					t.Errorf("log does not contain %s: %s", want, got)
+				}
+			}
+			if n := len(eventsNamed(rec.Ended()[0], "log")); n != 1 {
+				t.Errorf("span has %d log events, want 1", n)
+			}
+			if n := counterValue(t, "log.records", logBackendKey.String(backend), severity) - before; n != 1 {
+				t.Errorf("log.records increased by %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c, output := fileConfig(t, backend)
+			c.Level = InfoLevel
+			setTestConfig(t, c)
+
+			l := New(context.Background())
+			l.Debug("not wanted")
+			l.Warn("wanted")
+			New(ContextWithLevel(context.Background(), DebugLevel)).Debug("lowered")
+
+			got := readFile(t, output)
+			if strings.Contains(got, "not wanted") {
+				t.Errorf("debug log was written at info level: %s", got)
+			}
+			for _, want := range []string{"wanted", "lowered"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("log %q was not written: %s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestKvToMap(t *testing.T) {
+	tests := []struct {
+		kv   []any
+		want map[string]any
+	}{
+		{nil, map[string]any{}},
+		{[]any{"a", 1, "b", "x"}, map[string]any{"a": 1, "b": "x"}},
+		{[]any{"a"}, map[string]any{"!BADKEY": "a"}},
+		{[]any{42, "a", 1}, map[string]any{"!BADKEY": "42", "a": 1}},
+		{[]any{slog.Int("n", 3), "a", 1}, map[string]any{"n": int64(3), "a": 1}},
+	}
+	for _, tt := range tests {
+		if got := kvToMap(tt.kv); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("kvToMap(%v) = %v, want %v", tt.kv, got, tt.want)
+		}
+	}
+}
@@ -1,25 +1,24 @@
 package log
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"reflect"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
+	"unicode"
 
+	"github.com/komuw/otero/log/internal/attrconv"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	onceLogrus   sync.Once
-	logrusLogger *logrus.Entry
-)
+var logrusLogger *logrus.Entry
 
 // usage:
 //
@@ -27,28 +26,160 @@ var (
 //	l := NewLogrus(ctx)
 //	l.Info("hello world")
 func NewLogrus(ctx context.Context) *logrus.Entry {
-	onceLogrus.Do(func() {
-		l := logrus.New()
-		l.SetLevel(logrus.TraceLevel)
-		l.Formatter = &logrus.JSONFormatter{
-			FieldMap: logrus.FieldMap{
-				logrus.FieldKeyTime:  "timestamp",
-				logrus.FieldKeyLevel: "severity",
-				logrus.FieldKeyMsg:   "message",
-			},
-			TimestampFormat: time.RFC3339Nano,
-		}
-		l.AddHook(logrusTraceHook{})
-		l.SetReportCaller(true)
-		logrusLogger = l.WithField("app", "my_demo_app")
-	})
+	mu.RLock()
+	defer mu.RUnlock()
 
+	if lvl, ok := contextLevel(ctx, cfg.Level); ok {
+		return newLogrus(cfg, out, lvl).WithContext(ctx)
+	}
 	return logrusLogger.WithContext(ctx)
 }
 
+// setupLogrus is called, with mu held, each time the configuration changes.
+func setupLogrus(c Config, w io.Writer) {
+	logrusLogger = newLogrus(c, w, c.Level)
+}
+
+// newLogrus is called, with mu held, to create a logger whose level is lvl.
+func newLogrus(c Config, w io.Writer, lvl Level) *logrus.Entry {
+	l := logrus.New()
+	l.SetOutput(w)
+	l.SetLevel(logrusLevel(lvl))
+	l.Formatter = logrusFormatter{format: c.Format, schema: c.Schema, resource: resourceAttrs}
+	l.AddHook(logrusTraceHook{})
+	l.SetReportCaller(c.Caller)
+
+	fields := make(logrus.Fields, len(c.Fields))
+	for k, v := range c.Fields {
+		fields[k] = v
+	}
+	return l.WithFields(fields)
+}
+
+func logrusLevel(lvl Level) logrus.Level {
+	switch lvl {
+	case TraceLevel:
+		return logrus.TraceLevel
+	case DebugLevel:
+		return logrus.DebugLevel
+	case InfoLevel:
+		return logrus.InfoLevel
+	case WarnLevel:
+		return logrus.WarnLevel
+	case ErrorLevel:
+		return logrus.ErrorLevel
+	default:
+		return logrus.FatalLevel
+	}
+}
+
+// logrusFormatter formats logs like logrus.JSONFormatter & logrus.TextFormatter do,
+// except that levels use the same vocabulary as zerolog & slog; see Level.SeverityText
+type logrusFormatter struct {
+	format   string
+	schema   string
+	resource []attribute.KeyValue
+}
+
+func (f logrusFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b, err := f.formatEntry(entry)
+	if err == nil && isBuffered(levelFromLogrus(entry.Level)) {
+		if buf := bufferFromContext(entry.Context); buf != nil && buf.add(entry.Logger.Out, b) {
+			// logrus writes nothing for an empty log.
+			return nil, nil
+		}
+	}
+	return b, err
+}
+
+func (f logrusFormatter) formatEntry(entry *logrus.Entry) ([]byte, error) {
+	ts := entry.Time
+	keys := []string{normalizedTimeKey, normalizedSeverityKey, normalizedMessageKey}
+	if f.schema == SchemaNormalized {
+		ts = ts.UTC()
+		if entry.HasCaller() {
+			keys = append(keys, normalizedCallerKey)
+		}
+	} else if entry.HasCaller() {
+		keys = append(keys, "func", "file")
+	}
+
+	data := make(map[string]any, len(f.resource)+len(entry.Data)+len(keys))
+	for _, kv := range f.resource {
+		data[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			// Otherwise json.Marshal would encode most errors as `{}`
+			v = "<nil>"
+			if !attrconv.IsNilPointer(err) {
+				v = err.Error()
+			}
+		}
+		if slices.Contains(keys, k) {
+			// Like logrus does, do not let fields clobber the top-level keys.
+			k = "fields." + k
+		}
+		data[k] = v
+	}
+
+	data[normalizedTimeKey] = ts.Format(time.RFC3339Nano)
+	data[normalizedSeverityKey] = levelFromLogrus(entry.Level).SeverityText()
+	data[normalizedMessageKey] = entry.Message
+	if entry.HasCaller() {
+		caller := fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line)
+		if f.schema == SchemaNormalized {
+			data[normalizedCallerKey] = caller
+		} else {
+			data["func"] = entry.Caller.Function
+			data["file"] = caller
+		}
+	}
+
+	if f.format == FormatText {
+		return logfmt(data, keys), nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("log: failed to marshal fields to JSON: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// logfmt formats data as `key=value` pairs; the keys in first come first, followed by the rest in sorted order.
+func logfmt(data map[string]any, first []string) []byte {
+	var b bytes.Buffer
+	write := func(k string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		v := fmt.Sprint(data[k])
+		if v == "" || strings.ContainsAny(v, " =\"\\") || strings.ContainsFunc(v, func(r rune) bool { return !unicode.IsPrint(r) }) {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(v)
+	}
+
+	for _, k := range first {
+		write(k)
+	}
+	for _, k := range sortedKeys(data) {
+		if !slices.Contains(first, k) {
+			write(k)
+		}
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
 // logrusTraceHook is a hook that;
 // (a) adds TraceIds & spanIds to logs of all LogLevels
 // (b) adds logs to the active span as events.
+// (c) adds stack traces to logs of ErrorLevel & above.
+// (d) records errors in the log fields on the active span.
 type logrusTraceHook struct{}
 
 // Levels define on which log levels this hook would trigger
@@ -60,7 +191,27 @@ func (t logrusTraceHook) Levels() []logrus.Level {
 // It will;
 // (a) adds TraceIds & spanIds to logs of all LogLevels
 // (b) adds logs to the active span as events.
+// (c) adds stack traces to logs of ErrorLevel & above.
+// (d) records errors in the log fields on the active span.
 func (t logrusTraceHook) Fire(entry *logrus.Entry) error {
+	if entry.Caller != nil && isLoggingFrame(entry.Caller.Function) {
+		// The log call was made via a Logger, report its caller instead.
+		if f, ok := callerFrame(); ok {
+			entry.Caller = &f
+		}
+	}
+
+	countLog(entry.Context, BackendLogrus, levelFromLogrus(entry.Level))
+	failBuffer(entry.Context, levelFromLogrus(entry.Level))
+
+	errs := findErrors(entry.Data)
+	var stack string
+	if entry.Level <= logrus.ErrorLevel {
+		// (c) adds stack traces to logs.
+		stack = stackTrace(firstError(errs))
+		entry.Data[stackTraceKey] = stack
+	}
+
 	ctx := entry.Context
 	if ctx == nil {
 		return nil
@@ -70,124 +221,33 @@ func (t logrusTraceHook) Fire(entry *logrus.Entry) error {
 		return nil
 	}
 
-	{ // (a) adds TraceIds & spanIds to logs.
-		//
-		// TODO: (komuw) add stackTraces maybe.
-		//
-		sCtx := span.SpanContext()
-		if sCtx.HasTraceID() {
-			entry.Data["traceId"] = sCtx.TraceID().String()
-		}
-		if sCtx.HasSpanID() {
-			entry.Data["spanId"] = sCtx.SpanID().String()
-		}
-	}
-
 	{ // (b) adds logs to the active span as events.
 
 		// code from: https://github.com/uptrace/opentelemetry-go-extra/tree/main/otellogrus
 		// whose license(BSD 2-Clause) can be found at: https://github.com/uptrace/opentelemetry-go-extra/blob/v0.1.18/LICENSE
 
-		attrs := make([]attribute.KeyValue, 0, len(entry.Data)+2+3)
-
-		logSeverityKey := attribute.Key("log.severity")
-		logMessageKey := attribute.Key("log.message")
-		attrs = append(attrs, logSeverityKey.String(levelString(entry.Level)))
-		attrs = append(attrs, logMessageKey.String(entry.Message))
-
-		if entry.Caller != nil {
-			if entry.Caller.Function != "" {
-				attrs = append(attrs, semconv.CodeFunctionKey.String(entry.Caller.Function))
-			}
-			if entry.Caller.File != "" {
-				attrs = append(attrs, semconv.CodeFilepathKey.String(entry.Caller.File))
-				attrs = append(attrs, semconv.CodeLineNumberKey.Int(entry.Caller.Line))
-			}
-		}
+		attrs := logRecordAttrs(levelFromLogrus(entry.Level), entry.Message, entry.Caller, len(entry.Data))
 
-		for k, v := range entry.Data {
-			if k == "error" {
-				if err, ok := v.(error); ok {
-					typ := reflect.TypeOf(err).String()
-					attrs = append(attrs, semconv.ExceptionTypeKey.String(typ))
-					attrs = append(attrs, semconv.ExceptionMessageKey.String(err.Error()))
-					continue
-				}
+		for _, k := range sortedKeys(entry.Data) {
+			v := entry.Data[k]
+			if k == stackTraceKey {
+				// added to the exception event instead.
+				continue
 			}
 
-			attrs = append(attrs, toAttrKV(k, v))
+			attrs = attrconv.Append(attrs, k, v)
 		}
 
-		span.AddEvent("log", trace.WithAttributes(attrs...))
+		addLogEvent(span, levelFromLogrus(entry.Level), entry.Message, attrs)
+		recordErrors(span, errs, levelFromLogrus(entry.Level), entry.Message, stack)
+	}
 
-		if entry.Level <= logrus.ErrorLevel {
-			span.SetStatus(codes.Error, entry.Message)
+	{ // (a) adds TraceIds & spanIds to logs.
+		// This is done after (b), since the ids are already part of the span.
+		for _, kv := range correlationFields(span.SpanContext()) {
+			entry.Data[string(kv.Key)] = kv.Value.AsInterface()
 		}
 	}
 
 	return nil
 }
-
-func levelString(lvl logrus.Level) string {
-	s := lvl.String()
-	if s == "warning" {
-		s = "warn"
-	}
-	return strings.ToUpper(s)
-}
-
-func toAttrKV(key string, value interface{}) attribute.KeyValue {
-	switch value := value.(type) {
-	case nil:
-		return attribute.String(key, "<nil>")
-	case string:
-		return attribute.String(key, value)
-	case int:
-		return attribute.Int(key, value)
-	case int64:
-		return attribute.Int64(key, value)
-	case uint64:
-		return attribute.Int64(key, int64(value))
-	case float64:
-		return attribute.Float64(key, value)
-	case bool:
-		return attribute.Bool(key, value)
-	case fmt.Stringer:
-		return attribute.String(key, value.String())
-	}
-
-	rv := reflect.ValueOf(value)
-
-	switch rv.Kind() {
-	case reflect.Array:
-		rv = rv.Slice(0, rv.Len())
-		fallthrough
-	case reflect.Slice:
-		switch reflect.TypeOf(value).Elem().Kind() {
-		case reflect.Bool:
-			return attribute.BoolSlice(key, rv.Interface().([]bool))
-		case reflect.Int:
-			return attribute.IntSlice(key, rv.Interface().([]int))
-		case reflect.Int64:
-			return attribute.Int64Slice(key, rv.Interface().([]int64))
-		case reflect.Float64:
-			return attribute.Float64Slice(key, rv.Interface().([]float64))
-		case reflect.String:
-			return attribute.StringSlice(key, rv.Interface().([]string))
-		default:
-			return attribute.KeyValue{Key: attribute.Key(key)}
-		}
-	case reflect.Bool:
-		return attribute.Bool(key, rv.Bool())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return attribute.Int64(key, rv.Int())
-	case reflect.Float64:
-		return attribute.Float64(key, rv.Float())
-	case reflect.String:
-		return attribute.String(key, rv.String())
-	}
-	if b, err := json.Marshal(value); b != nil && err == nil {
-		return attribute.String(key, string(b))
-	}
-	return attribute.String(key, fmt.Sprint(value))
-}
@@ -0,0 +1,119 @@
+package log
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+func getMeter() metric.Meter {
+	return otel.GetMeterProvider().Meter(
+		pkgPath,
+		metric.WithInstrumentationVersion("0.0.1"),
+	)
+}
+
+// lazyCounter is an Int64Counter that is created on first use.
+// Unlike with sync.Once, a log made while the counter is being created(the OTel SDK logs via NewLogr & ErrorHandler)
+// does not deadlock; that log is just not counted.
+type lazyCounter struct {
+	name, description, unit string
+
+	creating atomic.Bool
+	counter  atomic.Pointer[metric.Int64Counter]
+}
+
+// get returns the counter, or nil if it is being created or could not be created.
+func (l *lazyCounter) get() metric.Int64Counter {
+	if c := l.counter.Load(); c != nil {
+		return *c
+	}
+	if !l.creating.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	c, err := getMeter().Int64Counter(
+		l.name,
+		metric.WithDescription(l.description),
+		metric.WithUnit(l.unit),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	if c == nil {
+		// Allow a later call to retry.
+		l.creating.Store(false)
+		return nil
+	}
+	l.counter.Store(&c)
+	return c
+}
+
+var (
+	logCounter = &lazyCounter{
+		name:        "log.records",
+		description: "how many log records have been emitted.",
+		unit:        "{record}",
+	}
+	sdkErrorCounter = &lazyCounter{
+		name:        "otel.sdk.errors",
+		description: "how many internal errors the OTel SDK has reported.",
+		unit:        "{error}",
+	}
+
+	logSeverityKey  = attribute.Key("severity")
+	logBackendKey   = attribute.Key("backend")
+	sdkComponentKey = attribute.Key("component")
+)
+
+// countLog increments the `log.records` counter, which is tagged with severity, backend & service name.
+// This enables alerting on things like the rate of error logs per service.
+func countLog(ctx context.Context, backend string, lvl Level) {
+	counter := logCounter.get()
+	if counter == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	mu.RLock()
+	serviceName := cfg.ServiceName
+	mu.RUnlock()
+
+	counter.Add(
+		ctx,
+		1,
+		metric.WithAttributes(
+			logSeverityKey.String(lvl.SeverityText()),
+			logBackendKey.String(backend),
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	)
+}
+
+// countSDKError increments the `otel.sdk.errors` counter, which is tagged with the component of the OTel SDK that failed.
+// This makes broken telemetry, like an exporter that cannot reach the collector, visible.
+func countSDKError(component string) {
+	counter := sdkErrorCounter.get()
+	if counter == nil {
+		return
+	}
+
+	mu.RLock()
+	serviceName := cfg.ServiceName
+	mu.RUnlock()
+
+	counter.Add(
+		context.Background(),
+		1,
+		metric.WithAttributes(
+			sdkComponentKey.String(component),
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	)
+}
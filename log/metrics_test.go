@@ -0,0 +1,45 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+func TestCountLog(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c, _ := fileConfig(t, backend)
+			c.ServiceName = "svc-" + backend
+			c.Level = InfoLevel
+			setTestConfig(t, c)
+
+			count := func(lvl Level) int64 {
+				return counterValue(t, "log.records",
+					logBackendKey.String(backend),
+					logSeverityKey.String(lvl.SeverityText()),
+					semconv.ServiceNameKey.String(c.ServiceName),
+				)
+			}
+			beforeWarn, beforeError, beforeDebug := count(WarnLevel), count(ErrorLevel), count(DebugLevel)
+
+			l := New(context.Background())
+			l.Warn("a")
+			l.Warn("b")
+			l.Error("c")
+			// below the configured level; not emitted, so not counted.
+			l.Debug("d")
+
+			if n := count(WarnLevel) - beforeWarn; n != 2 {
+				t.Errorf("WARN records = %d, want 2", n)
+			}
+			if n := count(ErrorLevel) - beforeError; n != 1 {
+				t.Errorf("ERROR records = %d, want 1", n)
+			}
+			if n := count(DebugLevel) - beforeDebug; n != 0 {
+				t.Errorf("DEBUG records = %d, want 0", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+)
+
+// The components of the OTel SDK that errors are attributed to; see countSDKError.
+const (
+	componentTrace       = "trace"
+	componentMetric      = "metric"
+	componentPropagation = "propagation"
+	componentOther       = "other"
+)
+
+// ErrorHandler returns an otel.ErrorHandler that logs the internal errors of the OTel SDK, like exporter failures,
+// and counts them in the `otel.sdk.errors` metric.
+// Otherwise those errors are printed to stderr, where they are easily missed.
+//
+// usage:
+//
+//	otel.SetErrorHandler(log.ErrorHandler())
+func ErrorHandler() otel.ErrorHandler {
+	return otel.ErrorHandlerFunc(func(err error) {
+		if err == nil {
+			return
+		}
+		component := errorComponent(err)
+		countSDKError(component)
+		New(context.Background()).Error("otel sdk error", "error", err, "otel.component", component)
+	})
+}
+
+// errorComponent guesses the component of the OTel SDK that err came from.
+// The SDK does not attach that information to its errors, but it usually mentions it in the error message;
+// eg `traces export: context deadline exceeded`
+func errorComponent(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "trace") || strings.Contains(msg, "span"):
+		return componentTrace
+	case strings.Contains(msg, "metric") || strings.Contains(msg, "instrument") || strings.Contains(msg, "meter"):
+		return componentMetric
+	case strings.Contains(msg, "baggage") || strings.Contains(msg, "propagat"):
+		return componentPropagation
+	default:
+		return componentOther
+	}
+}
+
+// NewLogr returns a logr.Logger that logs via the configured backend.
+// It is used by the OTel SDK to log things like dropped spans.
+// Like ErrorHandler, the logger is resolved on each log; so that it follows changes made by SetConfig & SetResource.
+//
+// usage:
+//
+//	otel.SetLogger(log.NewLogr())
+func NewLogr() logr.Logger {
+	return logr.New(logrSink{})
+}
+
+// logrSink implements logr.LogSink
+type logrSink struct {
+	name string
+	kv   []any
+}
+
+func (s logrSink) logger() Logger {
+	l := New(context.Background())
+	if len(s.kv) > 0 {
+		l = l.With(s.kv...)
+	}
+	return l
+}
+
+func (s logrSink) Init(info logr.RuntimeInfo) {}
+
+// logrLevel maps the verbosity of logr to a Level.
+// The OTel SDK logs warnings at V(1), info at V(4) & debug at V(8).
+func logrLevel(v int) Level {
+	switch {
+	case v <= 1:
+		return WarnLevel
+	case v <= 4:
+		return InfoLevel
+	case v <= 8:
+		return DebugLevel
+	default:
+		return TraceLevel
+	}
+}
+
+func (s logrSink) Enabled(v int) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return logrLevel(v) >= cfg.Level
+}
+
+func (s logrSink) Info(v int, msg string, kv ...any) {
+	switch logrLevel(v) {
+	case WarnLevel:
+		s.logger().Warn(s.message(msg), kv...)
+	case InfoLevel:
+		s.logger().Info(s.message(msg), kv...)
+	case DebugLevel:
+		s.logger().Debug(s.message(msg), kv...)
+	default:
+		s.logger().Trace(s.message(msg), kv...)
+	}
+}
+
+func (s logrSink) Error(err error, msg string, kv ...any) {
+	component := componentOther
+	if err != nil {
+		component = errorComponent(err)
+	}
+	countSDKError(component)
+	s.logger().Error(s.message(msg), append(kv, "error", err, "otel.component", component)...)
+}
+
+func (s logrSink) WithValues(kv ...any) logr.LogSink {
+	return logrSink{name: s.name, kv: append(s.kv[:len(s.kv):len(s.kv)], kv...)}
+}
+
+func (s logrSink) WithName(name string) logr.LogSink {
+	if s.name != "" {
+		name = s.name + "/" + name
+	}
+	return logrSink{name: name, kv: s.kv}
+}
+
+func (s logrSink) message(msg string) string {
+	if s.name == "" {
+		return msg
+	}
+	return s.name + ": " + msg
+}
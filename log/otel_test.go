@@ -0,0 +1,120 @@
+package log
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestErrorComponent(t *testing.T) {
+	tests := []struct {
+		err  string
+		want string
+	}{
+		{"traces export: context deadline exceeded", componentTrace},
+		{"span processor is shut down", componentTrace},
+		{"failed to upload metrics: connection refused", componentMetric},
+		{"invalid instrument name", componentMetric},
+		{"baggage: invalid member", componentPropagation},
+		{"disk is full", componentOther},
+	}
+	for _, tt := range tests {
+		if got := errorComponent(errors.New(tt.err)); got != tt.want {
+			t.Errorf("errorComponent(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	for _, backend := range backends {
+		c, output := fileConfig(t, backend)
+		setTestConfig(t, c)
+		before := counterValue(t, "otel.sdk.errors", sdkComponentKey.String(componentTrace))
+
+		ErrorHandler().Handle(errors.New("traces export: context deadline exceeded"))
+		ErrorHandler().Handle(nil)
+
+		if n := counterValue(t, "otel.sdk.errors", sdkComponentKey.String(componentTrace)) - before; n != 1 {
+			t.Errorf("%s: otel.sdk.errors = %d, want 1", backend, n)
+		}
+		got := readFile(t, output)
+		if strings.Count(got, "otel sdk error") != 1 || !strings.Contains(got, "context deadline exceeded") {
+			t.Errorf("%s: log = %s", backend, got)
+		}
+	}
+}
+
+func TestLogr(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c, first := fileConfig(t, backend)
+			c.Level = InfoLevel
+			setTestConfig(t, c)
+
+			// Created before the config is changed, like the logger that telemetry.Setup passes to the OTel SDK.
+			l := NewLogr().WithName("sdk").WithValues("exporter", "otlp")
+
+			c.Output = filepath.Join(t.TempDir(), "second.log")
+			c.Level = WarnLevel
+			if err := SetConfig(c); err != nil {
+				t.Fatalf("SetConfig() error = %v", err)
+			}
+
+			// The OTel SDK logs warnings at V(1), info at V(4) & debug at V(8).
+			if !l.V(1).Enabled() || l.V(4).Enabled() || l.V(8).Enabled() {
+				t.Errorf("Enabled() does not follow the configured level %v", c.Level)
+			}
+			l.V(1).Info("dropped spans", "count", 3)
+			l.V(4).Info("exporting")
+			l.WithName("batch").Error(errors.New("traces export: timeout"), "failed")
+			// The values of a derived logger are not added to its siblings.
+			_ = l.WithValues("unrelated", "x")
+			l.WithValues("queue", "spans").V(1).Info("queue is full")
+
+			if got := readFile(t, first); got != "" {
+				t.Errorf("the previous output was written to: %s", got)
+			}
+			got := readFile(t, c.Output)
+			for _, want := range []string{"sdk: dropped spans", `"exporter":"otlp"`, `"count":3`, "sdk/batch: failed", "timeout", `"queue":"spans"`} {
+				if !strings.Contains(got, want) {
+					t.Errorf("log does not contain %s: %s", want, got)
+				}
+			}
+			if strings.Contains(got, "exporting") || strings.Contains(got, "unrelated") {
+				t.Errorf("log contains a disabled log, or values of another logger: %s", got)
+			}
+		})
+	}
+}
+
+// failingMeterProvider is a MeterProvider whose counters can not be created.
+type failingMeterProvider struct{ noop.MeterProvider }
+
+func (failingMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter { return failingMeter{} }
+
+type failingMeter struct{ noop.Meter }
+
+func (failingMeter) Int64Counter(string, ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return nil, errors.New("meter: unavailable")
+}
+
+func TestLazyCounterRetries(t *testing.T) {
+	prev := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+
+	l := &lazyCounter{name: "test.counter"}
+	otel.SetMeterProvider(failingMeterProvider{})
+	if c := l.get(); c != nil {
+		t.Fatalf("get() = %v, want nil", c)
+	}
+
+	otel.SetMeterProvider(prev)
+	if c := l.get(); c == nil {
+		t.Error("get() after a failure = nil; it was not retried")
+	}
+}
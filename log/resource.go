@@ -0,0 +1,55 @@
+package log
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// DefaultResourceKeys are the resource attributes that are added to logs, if SetResource is not given any keys.
+var DefaultResourceKeys = []attribute.Key{
+	semconv.ServiceNameKey,
+	semconv.ServiceVersionKey,
+	semconv.DeploymentEnvironmentKey,
+}
+
+// resourceAttrs are the resource attributes added to every log record; both the logs and the log-derived span events.
+// It is guarded by mu.
+var resourceAttrs []attribute.KeyValue
+
+// SetResource adds the attributes of res whose keys are in keys(or DefaultResourceKeys, if none are given) to every log.
+// It is passed the resource of the TracerProvider & MeterProvider by telemetry.Setup
+//
+// usage:
+//
+//	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("svc"))
+//	log.SetResource(res)
+//	provider := trace.NewTracerProvider(trace.WithResource(res))
+func SetResource(res *resource.Resource, keys ...attribute.Key) {
+	if len(keys) == 0 {
+		keys = DefaultResourceKeys
+	}
+
+	var attrs []attribute.KeyValue
+	for _, k := range keys {
+		if v, ok := res.Set().Value(k); ok {
+			attrs = append(attrs, attribute.KeyValue{Key: k, Value: v})
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	resourceAttrs = attrs
+	setupLogrus(cfg, out)
+	setupZerolog(cfg, out)
+	setupSlog(cfg, out)
+}
+
+// getResourceAttrs returns the attributes set by SetResource.
+func getResourceAttrs() []attribute.KeyValue {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return resourceAttrs
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+func setTestResource(t *testing.T, res *resource.Resource, keys ...attribute.Key) {
+	t.Helper()
+
+	prev := getResourceAttrs()
+	SetResource(res, keys...)
+	t.Cleanup(func() { SetResource(resource.NewSchemaless(prev...), DefaultResourceKeys...) })
+}
+
+func TestSetResource(t *testing.T) {
+	res := resource.NewSchemaless(
+		semconv.ServiceNameKey.String("checkout"),
+		semconv.ServiceVersionKey.String("1.2.3"),
+		semconv.HostNameKey.String("box"),
+	)
+
+	for _, backend := range backends {
+		c, output := fileConfig(t, backend)
+		setTestConfig(t, c)
+		setTestResource(t, res)
+		ctx, span, rec := startSpan(t)
+
+		New(ctx).Info("hello")
+		span.End()
+
+		got := readFile(t, output)
+		for _, want := range []string{`"service.name":"checkout"`, `"service.version":"1.2.3"`} {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: log does not contain %s: %s", backend, want, got)
+			}
+		}
+		if strings.Contains(got, "host.name") {
+			t.Errorf("%s: log contains host.name, which is not one of the keys: %s", backend, got)
+		}
+
+		e := eventsNamed(rec.Ended()[0], "log")[0]
+		if v, ok := eventAttr(e, "service.name"); !ok || v.AsString() != "checkout" {
+			t.Errorf("%s: log event service.name = %q", backend, v.AsString())
+		}
+	}
+
+	c, output := fileConfig(t, BackendSlog)
+	setTestConfig(t, c)
+	setTestResource(t, res, semconv.HostNameKey)
+	New(context.Background()).Info("hello")
+	if got := readFile(t, output); !strings.Contains(got, `"host.name":"box"`) || strings.Contains(got, "service.name") {
+		t.Errorf("log does not have just the given keys: %s", got)
+	}
+}
@@ -0,0 +1,36 @@
+package log
+
+// The schemas of the top-level keys of logs.
+const (
+	// SchemaNative lets each logging backend use its own keys; eg `level` vs `severity`, `msg` vs `message`.
+	SchemaNative = "native"
+	// SchemaNormalized makes logrus, zerolog & slog emit the same top-level keys; timestamp, severity, message & caller.
+	// Timestamps are in UTC.
+	//
+	//	{"timestamp": "2023-01-27T07:09:58.444782364Z", "severity": "INFO", "message": "hello", "caller": "/src/service.go:155", ...}
+	SchemaNormalized = "normalized"
+)
+
+// The top-level keys used by SchemaNormalized.
+// Timestamps are in UTC & formatted as time.RFC3339Nano
+const (
+	normalizedTimeKey     = "timestamp"
+	normalizedSeverityKey = "severity"
+	normalizedMessageKey  = "message"
+	normalizedCallerKey   = "caller"
+)
+
+func validSchema(s string) bool {
+	return s == SchemaNative || s == SchemaNormalized
+}
+
+// isNormalizedKey reports whether k is one of the top-level keys of SchemaNormalized.
+// Log fields with such keys are renamed to `fields.<k>`, as logrus does, so that they do not clash.
+func isNormalizedKey(k string) bool {
+	switch k {
+	case normalizedTimeKey, normalizedSeverityKey, normalizedMessageKey, normalizedCallerKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchemaNormalized(t *testing.T) {
+	for _, backend := range backends {
+		c, output := fileConfig(t, backend)
+		c.Schema = SchemaNormalized
+		setTestConfig(t, c)
+
+		New(context.Background()).Info("hello", "severity", "clash", "msg", "m", "level", "l", "time", "t", "source", "s")
+
+		line := readFile(t, output)
+		var got map[string]any
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("%s: log is not json: %v", backend, err)
+		}
+		if dups := repeatedKeys(t, line); len(dups) > 0 {
+			t.Errorf("%s: keys %v are repeated in %s", backend, dups, line)
+		}
+		for _, k := range []string{normalizedTimeKey, normalizedSeverityKey, normalizedMessageKey, normalizedCallerKey} {
+			if _, ok := got[k]; !ok {
+				t.Errorf("%s: log does not have the %q key: %v", backend, k, got)
+			}
+		}
+		if got[normalizedSeverityKey] != "INFO" || got[normalizedMessageKey] != "hello" || got["fields.severity"] != "clash" {
+			t.Errorf("%s: log = %v", backend, got)
+		}
+		ts, _ := got[normalizedTimeKey].(string)
+		if parsed, err := time.Parse(time.RFC3339Nano, ts); err != nil || !strings.HasSuffix(ts, "Z") || parsed.IsZero() {
+			t.Errorf("%s: timestamp %q is not in UTC RFC3339Nano", backend, ts)
+		}
+	}
+}
+
+func TestSlogClashingKeys(t *testing.T) {
+	c, output := fileConfig(t, BackendSlog)
+	c.Caller = true
+	c.Fields = map[string]string{"time": "f"}
+	setTestConfig(t, c)
+
+	l := NewSlog(context.Background()).With("level", "w")
+	l.Info("hello", "msg", "m", "source", "s", slog.Group("g", "msg", "nested"))
+
+	line := readFile(t, output)
+	if dups := repeatedKeys(t, line); len(dups) > 0 {
+		t.Errorf("keys %v are repeated in %s", dups, line)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(line), &got); err != nil {
+		t.Fatalf("log is not json: %v", err)
+	}
+	want := map[string]any{
+		"msg": "hello", "level": "INFO", "fields.msg": "m", "fields.level": "w", "fields.source": "s", "fields.time": "f",
+		// Attrs in a group are not top-level, so they are left as is.
+		"g": map[string]any{"msg": "nested"},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("%s = %v, want %v; %s", k, got[k], v, line)
+		}
+	}
+}
+
+// repeatedKeys returns the top-level keys that appear more than once in the json object line; which json.Unmarshal hides.
+func repeatedKeys(t *testing.T, line string) []string {
+	t.Helper()
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	if _, err := dec.Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	seen := map[string]bool{}
+	var dups []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		k, _ := tok.(string)
+		if seen[k] {
+			dups = append(dups, k)
+		}
+		seen[k] = true
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+	}
+	return dups
+}
+
+// TestZerologConfigChange changes the configuration while zerolog is logging; it is meant to be run with -race.
+func TestZerologConfigChange(t *testing.T) {
+	c, _ := fileConfig(t, BackendZerolog)
+	setTestConfig(t, c)
+
+	var wg sync.WaitGroup
+	started, stop := make(chan struct{}), make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l := New(context.Background())
+		l.Info("hello")
+		close(started)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.Info("hello")
+			}
+		}
+	}()
+
+	<-started
+	for i := 0; i < 100; i++ {
+		c.Level = []Level{DebugLevel, InfoLevel, TraceLevel}[i%3]
+		if err := SetConfig(c); err != nil {
+			t.Fatalf("SetConfig() error = %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -2,17 +2,24 @@ package log
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
-	"os"
+	"runtime"
+	"time"
 
+	"github.com/komuw/otero/log/internal/attrconv"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var slogLogger *slog.Logger
+var (
+	slogHandler slog.Handler
+	// slogNewHandler returns a handler that is like slogHandler, but writes to w.
+	slogNewHandler func(w io.Writer) slog.Handler
+)
 
-// Also see: 
+// Also see:
 //   1. https://github.com/jba/slog/blob/main/trace/trace.go
 //   2. https://github.com/remychantenay/slog-otel
 
@@ -22,75 +29,222 @@ var slogLogger *slog.Logger
 //	l := NewSlog(ctx)
 //	l.Info("hello world")
 func NewSlog(ctx context.Context) *slog.Logger {
+	mu.RLock()
+	h := otelHandler{h: slogHandler, ctx: ctx}
+	if b := bufferFromContext(ctx); b != nil {
+		h.buffered = slogNewHandler(bufferWriter{b: b, w: out})
+	}
+	mu.RUnlock()
+
+	// The trace correlation fields are added by otelHandler.Handle
+	return slog.New(h)
+}
+
+// setupSlog is called, with mu held, each time the configuration changes.
+func setupSlog(c Config, w io.Writer) {
 	opts := slog.HandlerOptions{
-		AddSource: true,
-		Level:     slog.LevelDebug,
+		AddSource: c.Caller,
+		Level:     slogLevel(c.Level),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) != 0 {
+				return a
+			}
+			if a.Key == slog.LevelKey {
+				if lvl, ok := a.Value.Any().(slog.Level); ok {
+					a.Value = slog.StringValue(levelFromSlog(lvl).SeverityText())
+				}
+			}
+			if c.Schema == SchemaNormalized {
+				if isNormalizedKey(a.Key) {
+					a.Key = "fields." + a.Key
+				}
+				a = normalizeSlogAttr(a)
+			}
+			return a
+		},
 	}
-	jh := slog.NewJSONHandler(os.Stdout, &opts)
 
-	h := otelHandler{h: jh, ctx: ctx}
-	l := slog.New(h).With("app", "my_demo_app")
-	slogLogger = l
+	attrs := make([]slog.Attr, 0, len(resourceAttrs)+len(c.Fields))
+	for _, kv := range resourceAttrs {
+		attrs = append(attrs, clashFreeAttr(slog.Any(string(kv.Key), kv.Value.AsInterface())))
+	}
+	for _, k := range sortedKeys(c.Fields) {
+		attrs = append(attrs, clashFreeAttr(slog.String(k, c.Fields[k])))
+	}
+	slogNewHandler = func(w io.Writer) slog.Handler {
+		if c.Format == FormatText {
+			return slog.NewTextHandler(w, &opts).WithAttrs(attrs)
+		}
+		return slog.NewJSONHandler(w, &opts).WithAttrs(attrs)
+	}
+	slogHandler = slogNewHandler(w)
+}
 
-	traceId, spanId := getIds(ctx)
-	if traceId != "" && spanId != "" {
-		return slogLogger.With("traceId", traceId, "spanId", spanId)
+// clashFreeAttr prefixes the key of a, a top-level attr of the caller, with `fields.` if it is the key of one of the built-in attrs of slog;
+// time, level, msg & source. Like logrus does, so that a log has no repeated keys, and ReplaceAttr renames only the built-in attrs.
+func clashFreeAttr(a slog.Attr) slog.Attr {
+	switch a.Key {
+	case slog.TimeKey, slog.LevelKey, slog.MessageKey, slog.SourceKey:
+		a.Key = "fields." + a.Key
+	case "":
+		// The attrs of a group with an empty key are inlined.
+		if a.Value.Kind() == slog.KindGroup {
+			a.Value = slog.GroupValue(clashFreeAttrs(a.Value.Group())...)
+		}
 	}
+	return a
+}
 
-	return slogLogger
+func clashFreeAttrs(attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, clashFreeAttr(a))
+	}
+	return out
+}
+
+// normalizeSlogAttr renames the top-level keys of slog to those of SchemaNormalized.
+// It is only called with the built-in attrs of slog, since those of the caller are renamed by clashFreeAttr.
+func normalizeSlogAttr(a slog.Attr) slog.Attr {
+	switch a.Key {
+	case slog.TimeKey:
+		if t, ok := a.Value.Any().(time.Time); ok {
+			return slog.String(normalizedTimeKey, t.UTC().Format(time.RFC3339Nano))
+		}
+	case slog.LevelKey:
+		a.Key = normalizedSeverityKey
+	case slog.MessageKey:
+		a.Key = normalizedMessageKey
+	case slog.SourceKey:
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			return slog.String(normalizedCallerKey, fmt.Sprintf("%s:%d", src.File, src.Line))
+		}
+	}
+	return a
+}
+
+// slog has no trace level, so we use one that is below slog.LevelDebug.
+const slogLevelTrace = slog.LevelDebug - 4
+
+func slogLevel(lvl Level) slog.Level {
+	switch lvl {
+	case TraceLevel:
+		return slogLevelTrace
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	default:
+		return slogLevelFatal
+	}
 }
 
 // otelHandler implements slog.Handler
 // It adds;
 // (a) TraceIds & spanIds to logs.
 // (b) Logs(as events) to the active span.
+// (c) Stack traces to logs of LevelError & above.
+// (d) Errors in the log attributes to the active span.
+// (e) Trace & debug level logs to the Buffer of the request, if any.
 type otelHandler struct {
 	h slog.Handler
+	// buffered is like h, but writes to the Buffer in ctx. It is nil if ctx has no Buffer.
+	buffered slog.Handler
+	// grouped is set once a group is opened; the attrs that follow are not top-level, so they can not clash with the built-in ones.
+	grouped bool
 	// Do not store Contexts inside a struct type; https://pkg.go.dev/context
 	// todo: do better in future.
 	ctx context.Context
 }
 
-func (s otelHandler) Enabled(_ context.Context, _ slog.Level) bool {
-	return true /* support all logging levels*/
+func (s otelHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	if s.h.Enabled(ctx, l) {
+		return true
+	}
+
+	mu.RLock()
+	configured := cfg.Level
+	mu.RUnlock()
+	for _, c := range []context.Context{ctx, s.ctx} {
+		if lvl, ok := contextLevel(c, configured); ok && levelFromSlog(l) >= lvl {
+			return true
+		}
+	}
+	return false
 }
 
 func (s otelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return otelHandler{h: s.h.WithAttrs(attrs), ctx: s.ctx}
+	if !s.grouped {
+		attrs = clashFreeAttrs(attrs)
+	}
+	h := otelHandler{h: s.h.WithAttrs(attrs), ctx: s.ctx, grouped: s.grouped}
+	if s.buffered != nil {
+		h.buffered = s.buffered.WithAttrs(attrs)
+	}
+	return h
 }
 
 func (s otelHandler) WithGroup(name string) slog.Handler {
-	return otelHandler{h: s.h.WithGroup(name), ctx: s.ctx}
+	if name == "" {
+		// As the slog documentation requires of handlers, a group with an empty name is ignored.
+		return s
+	}
+	h := otelHandler{h: s.h.WithGroup(name), ctx: s.ctx, grouped: true}
+	if s.buffered != nil {
+		h.buffered = s.buffered.WithGroup(name)
+	}
+	return h
+}
+
+// handle writes r out, or holds it in the Buffer of the request; see (e).
+func (s otelHandler) handle(ctx context.Context, r slog.Record) error {
+	if !s.grouped {
+		attrs := make([]slog.Attr, 0, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = append(attrs, clashFreeAttr(a))
+			return true
+		})
+		r = slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+		r.AddAttrs(attrs...)
+	}
+	if s.buffered != nil && isBuffered(levelFromSlog(r.Level)) {
+		return s.buffered.Handle(ctx, r)
+	}
+	return s.h.Handle(ctx, r)
 }
 
 func (s otelHandler) Handle(ctx context.Context, r slog.Record) error {
+	countLog(ctx, BackendSlog, levelFromSlog(r.Level))
+	failBuffer(ctx, levelFromSlog(r.Level))
+	failBuffer(s.ctx, levelFromSlog(r.Level))
+
 	span := trace.SpanFromContext(ctx)
 	if !span.SpanContext().IsValid() {
 		span = trace.SpanFromContext(s.ctx)
 	}
 
-	if !span.IsRecording() {
-		return s.h.Handle(ctx, r)
+	errFields := map[string]any{}
+	r.Attrs(func(a slog.Attr) bool {
+		if err, ok := a.Value.Any().(error); ok {
+			errFields[a.Key] = err
+		}
+		return true
+	})
+	errs := findErrors(errFields)
+
+	var stack string
+	if r.Level >= slog.LevelError {
+		// (c) adds stack traces to logs.
+		stack = stackTrace(firstError(errs))
+		r.AddAttrs(slog.String(stackTraceKey, stack))
 	}
 
-	{ // (a) adds TraceIds & spanIds to logs.
-		//
-		// TODO:
-		//   (a) (komuw) add stackTraces maybe.
-		//   (b) there's a bug here, where sometimes duplicate traceId/spanId can be added.
-		//
-		sCtx := span.SpanContext()
-		attrs := make([]slog.Attr, 0)
-		traceId, spanId := getIds(ctx)
-		if traceId != "" && spanId != "" {
-			attrs = append(attrs,
-				slog.Attr{Key: "traceId", Value: slog.StringValue(sCtx.TraceID().String())},
-				slog.Attr{Key: "spanId", Value: slog.StringValue(sCtx.SpanID().String())},
-			)
-		}
-		if len(attrs) > 0 {
-			r.AddAttrs(attrs...)
-		}
+	if !span.IsRecording() {
+		return s.handle(ctx, r)
 	}
 
 	{ // (b) adds logs to the active span as events.
@@ -98,56 +252,57 @@ func (s otelHandler) Handle(ctx context.Context, r slog.Record) error {
 		// code from: https://github.com/uptrace/opentelemetry-go-extra/tree/main/otellogrus
 		// which is BSD 2-Clause license.
 
-		attrs := make([]attribute.KeyValue, 0)
+		mu.RLock()
+		reportCaller := cfg.Caller
+		mu.RUnlock()
 
-		logSeverityKey := attribute.Key("log.severity")
-		logMessageKey := attribute.Key("log.message")
-		attrs = append(attrs, logSeverityKey.String(r.Level.String()))
-		attrs = append(attrs, logMessageKey.String(r.Message))
+		var caller *runtime.Frame
+		if reportCaller && r.PC != 0 {
+			f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+			caller = &f
+		}
+
+		attrs := logRecordAttrs(levelFromSlog(r.Level), r.Message, caller, r.NumAttrs())
 
-		// TODO: Obey the following rules form the slog documentation:
-		//
-		// Handle methods that produce output should observe the following rules:
-		//   - If r.Time is the zero time, ignore the time.
-		//   - If an Attr's key is the empty string, ignore the Attr.
-		//
 		r.Attrs(func(a slog.Attr) bool {
-			attrs = append(attrs,
-				attribute.KeyValue{
-					Key:   attribute.Key(a.Key),
-					Value: attribute.StringValue(a.Value.String()),
-				},
-			)
+			if a.Key == stackTraceKey {
+				// added to the exception event instead.
+				return true
+			}
+			attrs = appendSlogAttr(attrs, "", a)
 			return true
 		})
-		// todo: add caller info.
 
-		span.AddEvent("log", trace.WithAttributes(attrs...))
-		if r.Level >= slog.LevelError {
-			span.SetStatus(codes.Error, r.Message)
-		}
+		addLogEvent(span, levelFromSlog(r.Level), r.Message, attrs)
+		recordErrors(span, errs, levelFromSlog(r.Level), r.Message, stack)
 	}
 
-	return s.h.Handle(ctx, r)
-}
-
-func getIds(ctx context.Context) (traceId, spanId string) {
-	if ctx == nil {
-		return
-	}
-	span := trace.SpanFromContext(ctx)
-	if !span.IsRecording() {
-		return
+	{ // (a) adds TraceIds & spanIds to logs.
+		// This is done after (b), since the ids are already part of the span.
+		for _, kv := range correlationFields(span.SpanContext()) {
+			r.AddAttrs(slog.Any(string(kv.Key), kv.Value.AsInterface()))
+		}
 	}
 
-	sCtx := span.SpanContext()
+	return s.handle(ctx, r)
+}
 
-	if sCtx.HasTraceID() {
-		traceId = sCtx.TraceID().String()
+// appendSlogAttr converts a into attributes; groups are flattened into dotted keys.
+// As the slog documentation requires of handlers, attrs with an empty key are ignored.
+func appendSlogAttr(attrs []attribute.KeyValue, prefix string, a slog.Attr) []attribute.KeyValue {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			// A group with an empty key is inlined.
+			prefix = prefix + a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			attrs = appendSlogAttr(attrs, prefix, ga)
+		}
+		return attrs
 	}
-	if sCtx.HasSpanID() {
-		spanId = sCtx.SpanID().String()
+	if a.Key == "" {
+		return attrs
 	}
-
-	return traceId, spanId
+	return attrconv.Append(attrs, prefix+a.Key, v.Any())
 }
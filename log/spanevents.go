@@ -0,0 +1,176 @@
+package log
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanEventsConfig controls which logs are added to the active span as events;
+// by level, by a budget per span & by deduplicating repeated messages. The log output is not affected by it.
+type SpanEventsConfig struct {
+	// MinLevel is the minimum level of logs that are added to spans.
+	MinLevel Level `json:"minLevel"`
+	// MaxPerSpan is the maximum number of log events added to a single span. Zero means no limit.
+	// The number of logs that were dropped is recorded in the `log.events.dropped` span attribute.
+	MaxPerSpan int `json:"maxPerSpan"`
+	// Dedup adds a repeated log message(same level & message) to a span only when its repeat count is a power of two.
+	// The repeat count is recorded in the `log.repeat_count` event attribute,
+	// and the number of logs that were deduplicated in the `log.events.deduplicated` span attribute.
+	Dedup bool `json:"dedup"`
+}
+
+// maxTrackedMessages bounds the memory used, per span, to deduplicate messages.
+const maxTrackedMessages = 1024
+
+var (
+	logEventsDroppedKey      = attribute.Key("log.events.dropped")
+	logEventsDeduplicatedKey = attribute.Key("log.events.deduplicated")
+	logRepeatCountKey        = attribute.Key("log.repeat_count")
+)
+
+type spanEventState struct {
+	mu           sync.Mutex
+	added        int
+	dropped      int
+	deduplicated int
+	repeats      map[string]int
+}
+
+// maxTrackedSpans bounds the number of spans whose state is held; see spanStateCache.
+const maxTrackedSpans = 4096
+
+// spanStates holds the state of each span that is logged to.
+var spanStates = &spanStateCache{}
+
+// spanStateCache holds a *spanEventState per trace.SpanID
+// Entries are removed when the span ends; see SpanProcessor.
+// A TracerProvider without SpanProcessor never reports that its spans end, so at most maxTrackedSpans are held.
+// The ones that were least recently logged to are evicted first; they get a fresh budget if logged to again.
+type spanStateCache struct {
+	mu sync.Mutex
+	// cur & prev are two generations of entries. Once cur has half of maxTrackedSpans, it replaces prev; whose entries are evicted.
+	// Entries of prev that are used again are moved to cur.
+	cur, prev map[trace.SpanID]*spanEventState
+}
+
+// get returns the state of the span id, creating it if it does not exist.
+func (c *spanStateCache) get(id trace.SpanID) *spanEventState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if st, ok := c.cur[id]; ok {
+		return st
+	}
+	st, ok := c.prev[id]
+	if ok {
+		delete(c.prev, id)
+	} else {
+		st = &spanEventState{}
+	}
+	if c.cur == nil || len(c.cur) >= maxTrackedSpans/2 {
+		c.prev, c.cur = c.cur, map[trace.SpanID]*spanEventState{}
+	}
+	c.cur[id] = st
+	return st
+}
+
+func (c *spanStateCache) load(id trace.SpanID) (*spanEventState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if st, ok := c.cur[id]; ok {
+		return st, true
+	}
+	st, ok := c.prev[id]
+	return st, ok
+}
+
+func (c *spanStateCache) delete(id trace.SpanID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.cur, id)
+	delete(c.prev, id)
+}
+
+func (c *spanStateCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.cur) + len(c.prev)
+}
+
+// addLogEvent adds a log event to span, subject to the SpanEventsConfig in use.
+func addLogEvent(span trace.Span, lvl Level, msg string, attrs []attribute.KeyValue) {
+	mu.RLock()
+	c := cfg.SpanEvents
+	mu.RUnlock()
+
+	if lvl < c.MinLevel {
+		return
+	}
+
+	if c.MaxPerSpan <= 0 && !c.Dedup {
+		// No state is needed.
+		span.AddEvent("log", trace.WithAttributes(attrs...))
+		return
+	}
+
+	st := spanStates.get(span.SpanContext().SpanID())
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if c.Dedup {
+		key := lvl.String() + "\x00" + msg
+		n, seen := st.repeats[key]
+		if seen || len(st.repeats) < maxTrackedMessages {
+			n++
+			if st.repeats == nil {
+				st.repeats = map[string]int{}
+			}
+			st.repeats[key] = n
+		}
+		if n > 1 {
+			if n&(n-1) != 0 {
+				st.deduplicated++
+				span.SetAttributes(logEventsDeduplicatedKey.Int(st.deduplicated))
+				return
+			}
+			attrs = append(attrs, logRepeatCountKey.Int(n))
+		}
+	}
+
+	if c.MaxPerSpan > 0 && st.added >= c.MaxPerSpan {
+		st.dropped++
+		span.SetAttributes(logEventsDroppedKey.Int(st.dropped))
+		return
+	}
+
+	st.added++
+	span.AddEvent("log", trace.WithAttributes(attrs...))
+}
+
+// SpanProcessor returns a span processor that releases the per span state used by SpanEventsConfig,
+// and marks the Buffer of a request as failed if any of its spans ends with an error status.
+// It should be registered with the TracerProvider.
+func SpanProcessor() sdktrace.SpanProcessor {
+	return spanEventsProcessor{}
+}
+
+type spanEventsProcessor struct{}
+
+func (p spanEventsProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	spanStates.delete(s.SpanContext().SpanID())
+	untrackSpanBuffer(s)
+}
+
+func (p spanEventsProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	trackSpanBuffer(parent, s)
+}
+
+func (p spanEventsProcessor) ForceFlush(ctx context.Context) error { return nil }
+func (p spanEventsProcessor) Shutdown(ctx context.Context) error   { return nil }
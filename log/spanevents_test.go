@@ -0,0 +1,168 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events SpanEventsConfig
+		log    func(Logger)
+
+		wantEvents       int
+		wantRepeats      []int64
+		wantDropped      int64
+		wantDeduplicated int64
+	}{
+		{
+			name:       "min level",
+			events:     SpanEventsConfig{MinLevel: InfoLevel},
+			log:        func(l Logger) { l.Debug("a"); l.Info("b"); l.Warn("c") },
+			wantEvents: 2,
+		},
+		{
+			name:   "max per span",
+			events: SpanEventsConfig{MinLevel: TraceLevel, MaxPerSpan: 3},
+			log: func(l Logger) {
+				for i := 0; i < 5; i++ {
+					l.Info(fmt.Sprint("msg ", i))
+				}
+			},
+			wantEvents:  3,
+			wantDropped: 2,
+		},
+		{
+			name:   "dedup",
+			events: SpanEventsConfig{MinLevel: TraceLevel, Dedup: true},
+			log: func(l Logger) {
+				for i := 0; i < 10; i++ {
+					l.Info("same")
+				}
+			},
+			// The repeats that are a power of two; 1, 2, 4 & 8.
+			wantEvents:       4,
+			wantRepeats:      []int64{2, 4, 8},
+			wantDeduplicated: 6,
+		},
+		{
+			name:   "dedup by level",
+			events: SpanEventsConfig{MinLevel: TraceLevel, Dedup: true},
+			log:    func(l Logger) { l.Info("same"); l.Warn("same") },
+			// Same message, different levels.
+			wantEvents: 2,
+		},
+		{
+			name:   "no dedup",
+			events: SpanEventsConfig{MinLevel: TraceLevel},
+			log: func(l Logger) {
+				for i := 0; i < 10; i++ {
+					l.Info("same")
+				}
+			},
+			wantEvents: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := fileConfig(t, BackendLogrus)
+			c.SpanEvents = tt.events
+			setTestConfig(t, c)
+			ctx, span, rec := startSpan(t)
+
+			tt.log(New(ctx))
+			span.End()
+
+			s := rec.Ended()[0]
+			events := eventsNamed(s, "log")
+			if len(events) != tt.wantEvents {
+				t.Errorf("got %d log events, want %d", len(events), tt.wantEvents)
+			}
+			var repeats []int64
+			for _, e := range events {
+				if v, ok := eventAttr(e, string(logRepeatCountKey)); ok {
+					repeats = append(repeats, v.AsInt64())
+				}
+			}
+			if !slices.Equal(repeats, tt.wantRepeats) {
+				t.Errorf("repeat counts = %v, want %v", repeats, tt.wantRepeats)
+			}
+
+			var dropped, deduplicated int64
+			for _, kv := range s.Attributes() {
+				switch kv.Key {
+				case logEventsDroppedKey:
+					dropped = kv.Value.AsInt64()
+				case logEventsDeduplicatedKey:
+					deduplicated = kv.Value.AsInt64()
+				}
+			}
+			if dropped != tt.wantDropped || deduplicated != tt.wantDeduplicated {
+				t.Errorf("dropped = %d, deduplicated = %d; want %d & %d", dropped, deduplicated, tt.wantDropped, tt.wantDeduplicated)
+			}
+
+			if _, ok := spanStates.load(s.SpanContext().SpanID()); ok {
+				t.Error("the state of the span was not released when it ended")
+			}
+		})
+	}
+}
+
+func TestSpanStatesBounded(t *testing.T) {
+	c, _ := fileConfig(t, BackendLogrus)
+	c.SpanEvents = SpanEventsConfig{MinLevel: TraceLevel, MaxPerSpan: 2}
+	setTestConfig(t, c)
+
+	// Without SpanProcessor, the end of the spans is never seen.
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	tracer := tp.Tracer("test")
+
+	var first trace.Span
+	for i := 0; i < 3*maxTrackedSpans; i++ {
+		ctx, span := tracer.Start(context.Background(), "span")
+		if first == nil {
+			first = span
+		}
+		New(ctx).Info("hello")
+		span.End()
+	}
+	if n := spanStates.len(); n == 0 || n > maxTrackedSpans {
+		t.Errorf("the state of %d spans is held, want some but at most %d", n, maxTrackedSpans)
+	}
+	if _, ok := spanStates.load(first.SpanContext().SpanID()); ok {
+		t.Error("the state of the least recently logged to span was not evicted")
+	}
+}
+
+func TestSpanStateCache(t *testing.T) {
+	c := &spanStateCache{}
+	id := func(i int) trace.SpanID { return trace.SpanID{byte(i >> 8), byte(i)} }
+
+	st := c.get(id(0))
+	st.added = 1
+	for i := 1; i < maxTrackedSpans; i++ {
+		// The first span is used throughout, so it is never evicted.
+		if got := c.get(id(0)); got != st {
+			t.Fatalf("get() of span 0 after %d spans returned a new state", i)
+		}
+		c.get(id(i))
+	}
+	if n := c.len(); n > maxTrackedSpans {
+		t.Errorf("len() = %d, want at most %d", n, maxTrackedSpans)
+	}
+	if _, ok := c.load(id(1)); ok {
+		t.Error("span 1 was not evicted")
+	}
+
+	c.delete(id(0))
+	if _, ok := c.load(id(0)); ok {
+		t.Error("span 0 was not deleted")
+	}
+}
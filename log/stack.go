@@ -0,0 +1,93 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// stackTraceKey is the log field that holds the stack trace of error logs.
+const stackTraceKey = "stacktrace"
+
+// stackTrace returns the stack trace carried by err, if any.
+// Otherwise, it returns the stack trace of the log call.
+func stackTrace(err error) string {
+	if pcs := errorStack(err); len(pcs) > 0 {
+		return formatStack(pcs)
+	}
+	return currentStack()
+}
+
+// errorStack returns the program counters of the innermost error in the chain that carries a stack.
+//
+// It understands errors that have either of the following methods;
+//
+//	StackTrace() errors.StackTrace // github.com/pkg/errors
+//	Callers() []uintptr
+func errorStack(err error) []uintptr {
+	var pcs []uintptr
+	for err != nil {
+		if s := framesOf(err); len(s) > 0 {
+			// keep going; the innermost stack is the one closest to where the error originated.
+			pcs = s
+		}
+		err = errors.Unwrap(err)
+	}
+	return pcs
+}
+
+func framesOf(err error) []uintptr {
+	if c, ok := err.(interface{ Callers() []uintptr }); ok {
+		return c.Callers()
+	}
+
+	// We do not want to import github.com/pkg/errors just for its StackTrace type, hence reflection.
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	out := m.Type().Out(0)
+	if out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	st := m.Call(nil)[0]
+	pcs := make([]uintptr, st.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(st.Index(i).Uint())
+	}
+	return pcs
+}
+
+// currentStack returns the stack trace of the log call, without the frames of this package & the logging backends.
+func currentStack() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	pcs = pcs[:n]
+
+	frames := runtime.CallersFrames(pcs)
+	skip := 0
+	for {
+		f, more := frames.Next()
+		if !isLoggingFrame(f.Function) || !more {
+			break
+		}
+		skip++
+	}
+	return formatStack(pcs[skip:])
+}
+
+// formatStack formats pcs like runtime/debug.Stack does.
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
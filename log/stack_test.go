@@ -0,0 +1,125 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// callersError carries a stack, like the errors of many error packages.
+type callersError struct {
+	msg string
+	pcs []uintptr
+}
+
+func (e callersError) Error() string      { return e.msg }
+func (e callersError) Callers() []uintptr { return e.pcs }
+
+//go:noinline
+func newCallersError(msg string) error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	return callersError{msg: msg, pcs: pcs[:n]}
+}
+
+// pkgErrorsStack mirrors the StackTrace type of github.com/pkg/errors
+type (
+	pkgErrorsFrame uintptr
+	pkgErrorsStack []pkgErrorsFrame
+)
+
+type pkgError struct{ pcs []uintptr }
+
+func (e pkgError) Error() string { return "pkg error" }
+
+func (e pkgError) StackTrace() pkgErrorsStack {
+	s := make(pkgErrorsStack, len(e.pcs))
+	for i, pc := range e.pcs {
+		s[i] = pkgErrorsFrame(pc)
+	}
+	return s
+}
+
+//go:noinline
+func newPkgError() error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	return pkgError{pcs: pcs[:n]}
+}
+
+func TestStackTrace(t *testing.T) {
+	inner := newCallersError("inner")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"Callers", newCallersError("x"), "log.newCallersError"},
+		{"pkg/errors", newPkgError(), "log.newPkgError"},
+		{"wrapped", fmt.Errorf("outer: %w", inner), "log.newCallersError"},
+	}
+	for _, tt := range tests {
+		got := stackTrace(tt.err)
+		if first, _, _ := strings.Cut(got, "\n"); !strings.HasSuffix(first, tt.want) {
+			t.Errorf("%s: stack starts with %q, want %q", tt.name, first, tt.want)
+		}
+	}
+
+	// The innermost stack is the one closest to where the error originated.
+	outer := callersError{msg: "outer", pcs: []uintptr{0}}
+	if got := errorStack(fmt.Errorf("wrap: %w", wrapErr{outer, inner})); len(got) == 0 || got[0] != inner.(callersError).pcs[0] {
+		t.Error("errorStack() did not return the innermost stack")
+	}
+
+	// Errors without a stack get the stack of the log call, without the frames of the logging packages.
+	got := stackTrace(errors.New("no stack"))
+	if strings.Contains(got, "log.currentStack") || strings.Contains(got, "log.stackTrace") {
+		t.Errorf("stack has frames of the log package: %s", got)
+	}
+	if got == "" {
+		t.Error("stackTrace() is empty")
+	}
+}
+
+type wrapErr struct {
+	callersError
+	inner error
+}
+
+func (w wrapErr) Unwrap() error { return w.inner }
+
+func TestErrorLogsHaveStackTraces(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			c, output := fileConfig(t, backend)
+			setTestConfig(t, c)
+			ctx, span, rec := startSpan(t)
+
+			l := New(ctx)
+			l.Info("no stack")
+			l.Error("failed", "error", newCallersError("boom"))
+			span.End()
+
+			lines := strings.Split(strings.TrimSpace(readFile(t, output)), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want 2", len(lines))
+			}
+			if strings.Contains(lines[0], stackTraceKey) {
+				t.Errorf("info log has a stack trace: %s", lines[0])
+			}
+			if !strings.Contains(lines[1], stackTraceKey) || !strings.Contains(lines[1], "newCallersError") {
+				t.Errorf("error log does not have the stack trace of its error: %s", lines[1])
+			}
+
+			exceptions := eventsNamed(rec.Ended()[0], "exception")
+			if len(exceptions) != 1 {
+				t.Fatalf("span has %d exception events, want 1", len(exceptions))
+			}
+			if v, ok := eventAttr(exceptions[0], "exception.stacktrace"); !ok || !strings.Contains(v.AsString(), "newCallersError") {
+				t.Errorf("exception event does not have the stack trace: %v", v.AsString())
+			}
+		})
+	}
+}
@@ -2,19 +2,23 @@ package log
 
 import (
 	"context"
-	"os"
-	"sync"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
 	"time"
 
+	"github.com/komuw/otero/log/internal/attrconv"
 	"github.com/rs/zerolog"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	onceZerolog   sync.Once
 	zerologLogger zerolog.Logger
+	// zerologWriter is the writer of zerologLogger.
+	zerologWriter io.Writer
+	// zerologSchema is the schema that the package-level variables of zerolog are set up for; see setupZerolog.
+	zerologSchema string
 )
 
 // usage:
@@ -23,24 +27,125 @@ var (
 //	l := NewZerolog(ctx)
 //	l.Info().Msg("hello world")
 func NewZerolog(ctx context.Context) zerolog.Logger {
-	onceZerolog.Do(func() {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return zerologForContext(zerologLogger.Hook(zerologTraceHook(ctx)), ctx, zerologWriter, cfg.Level)
+}
+
+// zerologForContext returns l with;
+// (a) the level set by ContextWithLevel, if it is lower than configured.
+// (b) its trace & debug level logs held in the Buffer of ctx, if any.
+// w is the writer that the logs are written to when the Buffer is flushed.
+func zerologForContext(l zerolog.Logger, ctx context.Context, w io.Writer, configured Level) zerolog.Logger {
+	if lvl, ok := contextLevel(ctx, configured); ok {
+		l = l.Level(zerologLevel(lvl))
+	}
+	b := bufferFromContext(ctx)
+	if b == nil {
+		return l
+	}
+	return l.Output(zerologBufferWriter{bufferWriter{b: b, w: w}})
+}
+
+// zerologBufferWriter implements zerolog.LevelWriter
+type zerologBufferWriter struct{ bufferWriter }
+
+func (z zerologBufferWriter) Write(p []byte) (int, error) {
+	return z.w.Write(p)
+}
+
+func (z zerologBufferWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	if l == zerolog.NoLevel || !isBuffered(levelFromZerolog(l)) {
+		return z.w.Write(p)
+	}
+	return z.bufferWriter.Write(p)
+}
+
+// setupZerolog is called, with mu held, each time the configuration changes.
+func setupZerolog(c Config, w io.Writer) {
+	if c.Schema != zerologSchema {
+		// zerolog reads its keys from package-level variables, without any locking, each time it logs.
+		// So they are only written when the schema changes; which is why the schema is only set at startup.
+		zerologSchema = c.Schema
 		zerolog.TimeFieldFormat = time.RFC3339Nano
-		l := zerolog.
-			New(os.Stdout).
-			With().
-			Timestamp().
-			Caller().
-			Str("app", "my_demo_app").
-			Logger()
-		zerologLogger = l
-	})
-
-	return zerologLogger.Hook(zerologTraceHook(ctx))
+		if c.Schema == SchemaNormalized {
+			zerolog.TimestampFieldName = normalizedTimeKey
+			zerolog.LevelFieldName = normalizedSeverityKey
+			zerolog.MessageFieldName = normalizedMessageKey
+			zerolog.CallerFieldName = normalizedCallerKey
+			zerolog.TimestampFunc = func() time.Time { return time.Now().UTC() }
+		} else {
+			zerolog.TimestampFieldName = "time"
+			zerolog.LevelFieldName = "level"
+			zerolog.MessageFieldName = "message"
+			zerolog.CallerFieldName = "caller"
+			zerolog.TimestampFunc = time.Now
+		}
+		zerolog.CallerMarshalFunc = zerologCallerMarshal
+		zerolog.LevelFieldMarshalFunc = func(l zerolog.Level) string {
+			return levelFromZerolog(l).SeverityText()
+		}
+	}
+	if c.Format == FormatText {
+		w = zerolog.ConsoleWriter{
+			Out:         w,
+			NoColor:     true,
+			TimeFormat:  time.RFC3339Nano,
+			FormatLevel: func(i any) string { return fmt.Sprint(i) },
+		}
+	}
+
+	zc := zerolog.
+		New(w).
+		Level(zerologLevel(c.Level)).
+		With().
+		Timestamp()
+	if c.Caller {
+		zc = zc.Caller()
+	}
+	for _, kv := range resourceAttrs {
+		zc = zc.Interface(string(kv.Key), kv.Value.AsInterface())
+	}
+	for _, k := range sortedKeys(c.Fields) {
+		zc = zc.Str(k, c.Fields[k])
+	}
+	zerologLogger = zc.Logger()
+	zerologWriter = w
+}
+
+// zerologCallerMarshal reports the caller of a Logger, rather than the Logger itself.
+func zerologCallerMarshal(pc uintptr, file string, line int) string {
+	if fn := runtime.FuncForPC(pc); fn != nil && isLoggingFrame(fn.Name()) {
+		if f, ok := callerFrame(); ok {
+			file, line = f.File, f.Line
+		}
+	}
+	return file + ":" + strconv.Itoa(line)
+}
+
+func zerologLevel(lvl Level) zerolog.Level {
+	switch lvl {
+	case TraceLevel:
+		return zerolog.TraceLevel
+	case DebugLevel:
+		return zerolog.DebugLevel
+	case InfoLevel:
+		return zerolog.InfoLevel
+	case WarnLevel:
+		return zerolog.WarnLevel
+	case ErrorLevel:
+		return zerolog.ErrorLevel
+	default:
+		return zerolog.FatalLevel
+	}
 }
 
 // zerologTraceHook is a hook that;
 // (a) adds TraceIds & spanIds to logs of all LogLevels
 // (b) adds logs to the active span as events.
+// (c) adds stack traces to logs of ErrorLevel & above.
+// (d) records errors in the log fields on the active span. Only errors logged via a Logger are visible to the hook.
 func zerologTraceHook(ctx context.Context) zerolog.HookFunc {
 	return func(e *zerolog.Event, level zerolog.Level, message string) {
 		if level == zerolog.NoLevel {
@@ -50,6 +155,19 @@ func zerologTraceHook(ctx context.Context) zerolog.HookFunc {
 			return
 		}
 
+		countLog(ctx, BackendZerolog, levelFromZerolog(level))
+		failBuffer(ctx, levelFromZerolog(level))
+
+		// The hook cannot see the fields of e, so they are handed over by zerologAdapter via the event's context.
+		fields := logFieldsFromContext(e.GetCtx())
+		errs := findErrors(fields)
+		var stack string
+		if level >= zerolog.ErrorLevel {
+			// (c) adds stack traces to logs.
+			stack = stackTrace(firstError(errs))
+			e.Str(stackTraceKey, stack)
+		}
+
 		if ctx == nil {
 			return
 		}
@@ -60,15 +178,8 @@ func zerologTraceHook(ctx context.Context) zerolog.HookFunc {
 		}
 
 		{ // (a) adds TraceIds & spanIds to logs.
-			//
-			// TODO: (komuw) add stackTraces maybe.
-			//
-			sCtx := span.SpanContext()
-			if sCtx.HasTraceID() {
-				e.Str("traceId", sCtx.TraceID().String())
-			}
-			if sCtx.HasSpanID() {
-				e.Str("spanId", sCtx.SpanID().String())
+			for _, kv := range correlationFields(span.SpanContext()) {
+				e.Interface(string(kv.Key), kv.Value.AsInterface())
 			}
 		}
 
@@ -79,20 +190,27 @@ func zerologTraceHook(ctx context.Context) zerolog.HookFunc {
 
 			// Unlike logrus or exp/slog, zerolog does not give hooks the ability to get the whole event/message with all its key-values
 			// see: https://github.com/rs/zerolog/issues/300
+			// Hence only the fields of logs made via a Logger are added.
+
+			mu.RLock()
+			reportCaller := cfg.Caller
+			mu.RUnlock()
+
+			var caller *runtime.Frame
+			if reportCaller {
+				// The hook is called synchronously by the log call, so the caller is still on the stack.
+				if f, ok := callerFrame(); ok {
+					caller = &f
+				}
+			}
 
-			attrs := make([]attribute.KeyValue, 0)
-
-			logSeverityKey := attribute.Key("log.severity")
-			logMessageKey := attribute.Key("log.message")
-			attrs = append(attrs, logSeverityKey.String(level.String()))
-			attrs = append(attrs, logMessageKey.String(message))
-
-			// todo: add caller info.
-
-			span.AddEvent("log", trace.WithAttributes(attrs...))
-			if level >= zerolog.ErrorLevel {
-				span.SetStatus(codes.Error, message)
+			attrs := logRecordAttrs(levelFromZerolog(level), message, caller, len(fields))
+			for _, k := range sortedKeys(fields) {
+				attrs = attrconv.Append(attrs, k, fields[k])
 			}
+
+			addLogEvent(span, levelFromZerolog(level), message, attrs)
+			recordErrors(span, errs, levelFromZerolog(level), message, stack)
 		}
 	}
 }
@@ -4,50 +4,210 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"github.com/komuw/otero/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const tracerName = "github.com/komuw/otero"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "certs" {
+		if err := runCerts(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var service string
 	flag.StringVar(
 		&service,
 		"service",
 		"",
 		"service to run")
+
+	logConf, err := log.ConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	var logFields string
+	flag.StringVar(&logConf.Backend, "log-backend", logConf.Backend, "logging backend used by services; logrus, zerolog or slog. env: OTERO_LOG_BACKEND")
+	flag.TextVar(&logConf.Level, "log-level", logConf.Level, "log level; trace, debug, info, warn or error. env: OTERO_LOG_LEVEL")
+	flag.StringVar(&logConf.Format, "log-format", logConf.Format, "log format; json or text. env: OTERO_LOG_FORMAT")
+	flag.StringVar(&logConf.Schema, "log-schema", logConf.Schema, "top-level keys of logs; native or normalized(identical for all backends). env: OTERO_LOG_SCHEMA")
+	flag.StringVar(&logConf.Output, "log-output", logConf.Output, "log destination; stdout, stderr or a file path. env: OTERO_LOG_OUTPUT")
+	flag.BoolVar(&logConf.Caller, "log-caller", logConf.Caller, "report the caller of log calls. env: OTERO_LOG_CALLER")
+	flag.StringVar(&logFields, "log-fields", log.FormatFields(logConf.Fields), "static fields added to all logs, eg; app=my_demo_app,team=x. env: OTERO_LOG_FIELDS")
+	flag.StringVar(&logConf.TraceFormat, "log-trace-format", logConf.TraceFormat, "format of the trace correlation fields in logs; default, w3c, ecs, gcp or datadog. env: OTERO_LOG_TRACE_FORMAT")
+	flag.StringVar(&logConf.GCPProjectID, "log-gcp-project", logConf.GCPProjectID, "google cloud project used by the gcp trace format. env: OTERO_LOG_GCP_PROJECT")
+	flag.TextVar(&logConf.SpanEvents.MinLevel, "log-span-events-level", logConf.SpanEvents.MinLevel, "minimum level of logs added to spans as events. env: OTERO_LOG_SPAN_EVENTS_LEVEL")
+	flag.IntVar(&logConf.SpanEvents.MaxPerSpan, "log-span-events-max", logConf.SpanEvents.MaxPerSpan, "maximum number of log events per span, 0 means no limit. env: OTERO_LOG_SPAN_EVENTS_MAX")
+	flag.BoolVar(&logConf.SpanEvents.Dedup, "log-span-events-dedup", logConf.SpanEvents.Dedup, "deduplicate repeated log events in a span. env: OTERO_LOG_SPAN_EVENTS_DEDUP")
+	var logAdminAddr string
+	flag.StringVar(&logAdminAddr, "log-admin-addr", os.Getenv("OTERO_LOG_ADMIN_ADDR"), "address of the unauthenticated /admin/log endpoint; defaults to 127.0.0.1:9081 for service A & 127.0.0.1:9082 for B, and off disables it. env: OTERO_LOG_ADMIN_ADDR")
+	var debugTokens, debugSecret string
+	flag.StringVar(&debugTokens, "debug-trace-tokens", os.Getenv("OTERO_DEBUG_TRACE_TOKENS"), "comma separated tokens that, when sent in the X-Debug-Trace header, force a request to be debugged. env: OTERO_DEBUG_TRACE_TOKENS")
+	flag.StringVar(&debugSecret, "debug-trace-secret", os.Getenv("OTERO_DEBUG_TRACE_SECRET"), "key used to verify signed X-Debug-Trace tokens. env: OTERO_DEBUG_TRACE_SECRET")
+	debugMaxTTL := time.Hour
+	if v := os.Getenv("OTERO_DEBUG_TRACE_MAX_TTL"); v != "" {
+		debugMaxTTL, err = time.ParseDuration(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	flag.DurationVar(&debugMaxTTL, "debug-trace-max-ttl", debugMaxTTL, "signed X-Debug-Trace tokens that expire further than this in the future are rejected. env: OTERO_DEBUG_TRACE_MAX_TTL")
+	tlsConf, err := telemetry.TLSConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	var cipherSuites string
+	flag.BoolVar(&tlsConf.Insecure, "telemetry-tls-insecure", tlsConf.Insecure, "export telemetry in plaintext, without TLS; only for local development. It turns off -telemetry-tls-mutual. env: OTERO_TELEMETRY_TLS_INSECURE")
+	flag.BoolVar(&tlsConf.MutualTLS, "telemetry-tls-mutual", tlsConf.MutualTLS, "present a client certificate to the otel collector. env: OTERO_TELEMETRY_TLS_MUTUAL")
+	flag.StringVar(&tlsConf.CAFile, "telemetry-tls-ca-file", tlsConf.CAFile, "root CA used to verify the otel collector. env: OTERO_TELEMETRY_TLS_CA_FILE")
+	flag.BoolVar(&tlsConf.SystemRoots, "telemetry-tls-system-roots", tlsConf.SystemRoots, "also verify the otel collector against the system's root CAs. env: OTERO_TELEMETRY_TLS_SYSTEM_ROOTS")
+	flag.StringVar(&tlsConf.CertFile, "telemetry-tls-cert-file", tlsConf.CertFile, "client certificate used for mutual TLS. env: OTERO_TELEMETRY_TLS_CERT_FILE")
+	flag.StringVar(&tlsConf.KeyFile, "telemetry-tls-key-file", tlsConf.KeyFile, "client key used for mutual TLS. env: OTERO_TELEMETRY_TLS_KEY_FILE")
+	flag.StringVar(&tlsConf.ServerName, "telemetry-tls-server-name", tlsConf.ServerName, "server name(SNI) of the otel collector; defaults to the host of its endpoint. env: OTERO_TELEMETRY_TLS_SERVER_NAME")
+	flag.StringVar(&tlsConf.MinVersion, "telemetry-tls-min-version", tlsConf.MinVersion, "minimum TLS version; 1.2 or 1.3. env: OTERO_TELEMETRY_TLS_MIN_VERSION")
+	flag.IntVar(&tlsConf.ExpiryWarningDays, "telemetry-tls-expiry-warning-days", tlsConf.ExpiryWarningDays, "warn at startup if a TLS certificate expires within this many days; 0 disables it. env: OTERO_TELEMETRY_TLS_EXPIRY_WARNING_DAYS")
+	flag.StringVar(&cipherSuites, "telemetry-tls-cipher-suites", strings.Join(tlsConf.CipherSuites, ","), "comma separated TLS 1.2 cipher suites, eg; TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. env: OTERO_TELEMETRY_TLS_CIPHER_SUITES")
+	serviceMTLS := false
+	if v := os.Getenv("OTERO_SERVICE_TLS"); v != "" {
+		serviceMTLS, err = strconv.ParseBool(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	serviceTLS := telemetry.TLSConfig{
+		MutualTLS:  true,
+		CAFile:     os.Getenv("OTERO_SERVICE_TLS_CA_FILE"),
+		CertFile:   os.Getenv("OTERO_SERVICE_TLS_CERT_FILE"),
+		KeyFile:    os.Getenv("OTERO_SERVICE_TLS_KEY_FILE"),
+		MinVersion: "1.2",
+	}
+	flag.BoolVar(&serviceMTLS, "service-tls", serviceMTLS, "serve, and call the other service, over mutual TLS. env: OTERO_SERVICE_TLS")
+	flag.StringVar(&serviceTLS.CAFile, "service-tls-ca-file", serviceTLS.CAFile, "root CA used to verify the other service; defaults to -telemetry-tls-ca-file. env: OTERO_SERVICE_TLS_CA_FILE")
+	flag.StringVar(&serviceTLS.CertFile, "service-tls-cert-file", serviceTLS.CertFile, "certificate of the service; defaults to ./confs/tls/service_<service>.crt env: OTERO_SERVICE_TLS_CERT_FILE")
+	flag.StringVar(&serviceTLS.KeyFile, "service-tls-key-file", serviceTLS.KeyFile, "key of the service; defaults to ./confs/tls/service_<service>.key env: OTERO_SERVICE_TLS_KEY_FILE")
+	prometheusMetrics := false
+	if v := os.Getenv("OTERO_METRICS_PROMETHEUS"); v != "" {
+		prometheusMetrics, err = strconv.ParseBool(v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	flag.BoolVar(&prometheusMetrics, "metrics-prometheus", prometheusMetrics, "serve metrics at /metrics for scraping by prometheus, in addition to exporting them to the otel collector. env: OTERO_METRICS_PROMETHEUS")
+	var clientTrace string
+	flag.StringVar(&clientTrace, "http-client-trace", os.Getenv("OTERO_HTTP_CLIENT_TRACE"), "how the DNS lookup, connect, TLS handshake & wait for the first byte of outbound requests are traced; off(the default), events(on the client span) or spans(child spans). env: OTERO_HTTP_CLIENT_TRACE")
 	flag.Parse()
 
 	service = strings.ToLower(service)
 	if service == "" {
 		panic("specify a service")
 	}
-
-	ctx := context.Background()
 	serviceName := fmt.Sprintf("otero-svc-%s", strings.ToUpper(service))
-	{
-		tp, err := setupTracing(ctx, serviceName)
-		if err != nil {
-			panic(err)
+
+	logConf.Fields, err = log.ParseFields(logFields)
+	if err != nil {
+		panic(err)
+	}
+
+	tlsConf.CipherSuites = nil
+	if cipherSuites != "" {
+		tlsConf.CipherSuites = strings.Split(cipherSuites, ",")
+	}
+
+	traceMode, err := telemetry.ParseClientTraceMode(clientTrace)
+	if err != nil {
+		panic(err)
+	}
+
+	debug := debugVerifier{secret: []byte(debugSecret), maxTTL: debugMaxTTL}
+	if debugTokens != "" {
+		debug.tokens = strings.Split(debugTokens, ",")
+	}
+
+	// ctx is cancelled on SIGINT/SIGTERM, which starts a graceful shutdown.
+	ctx, stop := withSignals(context.Background())
+	defer stop()
+
+	shutdown, err := telemetry.Setup(ctx, telemetry.Config{
+		ServiceName: serviceName,
+		Attributes:  []attribute.KeyValue{attribute.String("name", "komu")},
+		// Requests with a trusted `X-Debug-Trace` header are always sampled; see debugHandler.
+		Sampler:    debugSampler{next: telemetry.DefaultSampler()},
+		Log:        &logConf,
+		TLS:        &tlsConf,
+		Prometheus: prometheusMetrics,
+	})
+	if err != nil {
+		panic(err)
+	}
+	// shutdownTelemetry flushes the final batches of traces & metrics.
+	// It runs after the servers have drained, so that the telemetry of the drained requests is not lost.
+	shutdownTelemetry := func() {
+		// ctx is cancelled by now, but the flush still needs a live context.
+		ctx := context.WithoutCancel(ctx)
+		l := log.New(ctx)
+		l.Info("flushing telemetry")
+		if err := shutdown(ctx); err != nil {
+			l.Error("failed to shutdown telemetry", "error", err)
+			return
 		}
-		defer func() {
-			err := tp.Shutdown(ctx)
-			fmt.Println("error when shutting down tracingProvider. err: ", err)
-		}()
+		l.Info("telemetry flushed")
+	}
+	defer shutdownTelemetry()
 
-		mp, err := setupMetrics(ctx, serviceName)
+	// creds are nil, unless mutual TLS between the services is enabled.
+	var creds *telemetry.Credentials
+	if serviceMTLS {
+		if serviceTLS.CAFile == "" {
+			serviceTLS.CAFile = tlsConf.CAFile
+		}
+		if serviceTLS.CertFile == "" {
+			serviceTLS.CertFile = fmt.Sprintf("./confs/tls/service_%s.crt", service)
+		}
+		if serviceTLS.KeyFile == "" {
+			serviceTLS.KeyFile = fmt.Sprintf("./confs/tls/service_%s.key", service)
+		}
+		serviceTLS.ExpiryWarningDays = tlsConf.ExpiryWarningDays
+		// The certificate is also served to the other service, so it needs a SAN for this service's host.
+		creds, err = telemetry.NewCredentials(ctx, serviceTLS, fmt.Sprintf("otero_service_%s", service))
 		if err != nil {
 			panic(err)
 		}
-		defer func() {
-			err := mp.Shutdown(ctx)
-			fmt.Println("error when shutting down metricsProvider. err: ", err)
+	}
+
+	port := 8082
+	if service == "a" {
+		port = 8081
+	}
+	if logAdminAddr == "" {
+		logAdminAddr = fmt.Sprintf("127.0.0.1:%d", port+1000)
+	}
+	if logAdminAddr != "off" {
+		go func() {
+			if err := serve(ctx, adminServer(logAdminAddr), logAdminAddr); err != nil {
+				log.New(ctx).Error("admin server failed", "address", logAdminAddr, "error", err)
+			}
 		}()
 	}
 
 	if service == "a" {
-		serviceA(ctx, 8081)
+		err = serviceA(ctx, port, debug, creds, traceMode)
 	} else {
-		serviceB(ctx, 8082)
+		err = serviceB(ctx, port, debug, creds)
+	}
+	if err != nil {
+		log.New(ctx).Error("service failed", "service", serviceName, "error", err)
+		// os.Exit does not run deferred functions.
+		shutdownTelemetry()
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// peerHandler returns a http.Handler that records the identity of the client certificate, if any, on the server span.
+// It should wrap h inside of the otelhttp handler, so that requests have a span.
+func peerHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			trace.SpanFromContext(r.Context()).SetAttributes(peerAttributes("tls.client", r.TLS)...)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// peerTransport is a http.RoundTripper that records the identity of the server certificate, if any, on the client span.
+// It should be wrapped by the otelhttp transport, so that requests have a span.
+type peerTransport struct {
+	next http.RoundTripper
+}
+
+func (p peerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := p.next.RoundTrip(r)
+	if err == nil && resp.TLS != nil {
+		trace.SpanFromContext(r.Context()).SetAttributes(peerAttributes("tls.server", resp.TLS)...)
+	}
+	return resp, err
+}
+
+// peerAttributes returns the identity of the peer in cs; the subject, issuer & SANs of its certificate.
+// prefix is `tls.client` on server spans, and `tls.server` on client spans.
+func peerAttributes(prefix string, cs *tls.ConnectionState) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(cs.Version), "TLS ")),
+		attribute.String("tls.cipher", tls.CipherSuiteName(cs.CipherSuite)),
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return attrs
+	}
+
+	cert := cs.PeerCertificates[0]
+	attrs = append(attrs,
+		attribute.String(prefix+".subject", cert.Subject.String()),
+		attribute.String(prefix+".issuer", cert.Issuer.String()),
+		attribute.String(prefix+".not_after", cert.NotAfter.UTC().Format(time.RFC3339)),
+	)
+	if len(cert.DNSNames) > 0 {
+		attrs = append(attrs, attribute.StringSlice(prefix+".san.dns", cert.DNSNames))
+	}
+	uris := []string{}
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+		if u.Scheme == "spiffe" {
+			// The SPIFFE ID is the identity of a workload; see https://spiffe.io/docs/latest/spiffe-about/spiffe-concepts/#spiffe-id
+			attrs = append(attrs, attribute.String(prefix+".spiffe_id", u.String()))
+		}
+	}
+	if len(uris) > 0 {
+		attrs = append(attrs, attribute.StringSlice(prefix+".san.uri", uris))
+	}
+	return attrs
+}
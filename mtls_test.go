@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPeerAttributes(t *testing.T) {
+	ca, caKey, err := generateCert(certSpec{name: "ca", subject: "/O=MyOrg/CN=myOrgCA", keyType: keyTypeECDSA, days: 1}, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("generateCert() error = %v", err)
+	}
+	cert, _, err := generateCert(certSpec{
+		name:    "service_a",
+		subject: "/O=MyOrg/CN=otero_service_a",
+		sans:    "otero_service_a,127.0.0.1,spiffe://otero/service/a,https://otero/a",
+		keyType: keyTypeECDSA,
+		days:    1,
+	}, ca, caKey, 0)
+	if err != nil {
+		t.Fatalf("generateCert() error = %v", err)
+	}
+
+	cs := &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		PeerCertificates: []*x509.Certificate{cert, ca},
+	}
+	got := attribute.NewSet(peerAttributes("tls.client", cs)...)
+	want := map[attribute.Key]attribute.Value{
+		"tls.protocol.version": attribute.StringValue("1.3"),
+		"tls.cipher":           attribute.StringValue("TLS_AES_128_GCM_SHA256"),
+		"tls.client.subject":   attribute.StringValue("CN=otero_service_a,O=MyOrg"),
+		"tls.client.issuer":    attribute.StringValue("CN=myOrgCA,O=MyOrg"),
+		"tls.client.san.dns":   attribute.StringSliceValue([]string{"otero_service_a"}),
+		"tls.client.san.uri":   attribute.StringSliceValue([]string{"spiffe://otero/service/a", "https://otero/a"}),
+		"tls.client.spiffe_id": attribute.StringValue("spiffe://otero/service/a"),
+		"tls.client.not_after": attribute.StringValue(cert.NotAfter.UTC().Format(time.RFC3339)),
+	}
+	if got.Len() != len(want) {
+		t.Errorf("peerAttributes() = %v, want %d attributes", got.ToSlice(), len(want))
+	}
+	for k, v := range want {
+		if gv, ok := got.Value(k); !ok || gv != v {
+			t.Errorf("%s = %v, want %v", k, gv.Emit(), v.Emit())
+		}
+	}
+
+	// Without a peer certificate, only the connection is described.
+	got = attribute.NewSet(peerAttributes("tls.server", &tls.ConnectionState{Version: tls.VersionTLS12})...)
+	if _, ok := got.Value("tls.server.subject"); ok || got.Len() != 2 {
+		t.Errorf("peerAttributes() without a certificate = %v", got.ToSlice())
+	}
+}
+
+func TestPeerHandlerAndTransport(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+	tracer := tp.Tracer("test")
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// The client span has the identity of the server.
+	ctx, span := tracer.Start(context.Background(), "client")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := peerTransport{next: srv.Client().Transport}.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	// The server span has the identity of the client; which did not present a certificate here.
+	ctx, span = tracer.Start(context.Background(), "server")
+	req = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	peerHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	span.End()
+
+	// Plaintext requests have no TLS attributes.
+	ctx, span = tracer.Start(context.Background(), "plaintext")
+	req = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	peerHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	span.End()
+
+	spans := rec.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	attrs := func(s sdktrace.ReadOnlySpan) *attribute.Set { set := attribute.NewSet(s.Attributes()...); return &set }
+	if v, ok := attrs(spans[0]).Value("tls.server.san.dns"); !ok || len(v.AsStringSlice()) == 0 {
+		t.Errorf("client span attributes = %v, want the SANs of the server", spans[0].Attributes())
+	}
+	if _, ok := attrs(spans[1]).Value("tls.protocol.version"); !ok {
+		t.Errorf("server span attributes = %v, want the TLS version", spans[1].Attributes())
+	}
+	if len(spans[2].Attributes()) != 0 {
+		t.Errorf("plaintext span attributes = %v, want none", spans[2].Attributes())
+	}
+}
@@ -7,131 +7,155 @@ import (
 	"net/http"
 
 	"github.com/komuw/otero/log"
+	"github.com/komuw/otero/telemetry"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	sdkmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/trace"
 )
 
 // curl -vkL http://127.0.0.1:8081/serviceA
-func serviceA(ctx context.Context, port int) {
+// curl -vkL -H 'Accept: application/openmetrics-text' http://127.0.0.1:8081/metrics
+//
+// If creds is not nil, serviceA serves, and calls serviceB, over mutual TLS;
+// curl -vkL --cert confs/tls/client.crt --key confs/tls/client.key https://127.0.0.1:8081/serviceA
+//
+// clientTrace is how the phases of the calls to serviceB are traced.
+func serviceA(ctx context.Context, port int, debug debugVerifier, creds *telemetry.Credentials, clientTrace telemetry.ClientTraceMode) error {
 	serverPort := fmt.Sprintf(":%d", port)
 	address := fmt.Sprintf("127.0.0.1%s", serverPort)
 	var mux http.ServeMux
 
-	mux.HandleFunc("/serviceA", serviceA_HttpHandler)
+	// When serviceA is called, it calls serviceB over tcp network.
+	// We should still be able to propagate traces over a tcp network.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	serviceBURL := "http://otero_service_b:8082/serviceB"
+	if creds != nil {
+		transport.TLSClientConfig = creds.ClientConfig()
+		serviceBURL = "https://otero_service_b:8082/serviceB"
+	}
+	cli := &http.Client{
+		Transport: otelhttp.NewTransport(
+			// The DNS lookup, connect, TLS handshake & wait for the first byte of calls to serviceB are traced, if enabled.
+			telemetry.ClientTrace(telemetry.ClientMetrics(peerTransport{next: transport}), clientTrace),
+			// If you did not set the global propagator as shown in `telemetry/telemetry.go`
+			// then you need to provide this one
+			// otelhttp.WithPropagators(propagator),
+		),
+	}
+
+	mux.HandleFunc("/serviceA", serviceA_HttpHandler(cli, serviceBURL))
+	if h := telemetry.MetricsHandler(); h != nil {
+		mux.Handle("/metrics", h)
+	}
 
 	handler := otelhttp.NewHandler(
-		&mux,
+		// debug logs are only written out for failed requests.
+		peerHandler(log.BufferHandler(telemetry.ServerMetrics(&mux), log.DefaultBufferSize)),
 		"server.http",
-		// If you did not set the global propagator as shown in `tracing.go`
+		// The semantic convention http metrics are recorded by telemetry.ServerMetrics instead.
+		otelhttp.WithMeterProvider(noop.NewMeterProvider()),
+		// If you did not set the global propagator as shown in `telemetry/telemetry.go`
 		// then you need to provide this one
 		// otelhttp.WithPropagators(propagator),
 	)
 	server := &http.Server{
 		Addr:    serverPort,
-		Handler: handler,
+		Handler: debugHandler(handler, debug),
 	}
-
-	log := log.NewLogrus(ctx)
-	log.Info("serviceA listening on: ", address)
-	err := server.ListenAndServe()
-	if err != nil {
-		panic(err)
+	if creds != nil {
+		tlsConf, err := creds.ServerConfig()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConf
 	}
+
+	return serve(ctx, server, address)
 }
 
 // curl -vkL http://127.0.0.1:8082/serviceB
-func serviceB(ctx context.Context, port int) {
+// curl -vkL -H 'Accept: application/openmetrics-text' http://127.0.0.1:8082/metrics
+//
+// If creds is not nil, serviceB serves over mutual TLS.
+func serviceB(ctx context.Context, port int, debug debugVerifier, creds *telemetry.Credentials) error {
 	serverPort := fmt.Sprintf(":%d", port)
 	address := fmt.Sprintf("127.0.0.1%s", serverPort)
 	var mux http.ServeMux
 	mux.HandleFunc("/serviceB", serviceB_HttpHandler)
+	if h := telemetry.MetricsHandler(); h != nil {
+		mux.Handle("/metrics", h)
+	}
 
 	handler := otelhttp.NewHandler(
-		&mux,
+		// debug logs are only written out for failed requests.
+		peerHandler(log.BufferHandler(telemetry.ServerMetrics(&mux), log.DefaultBufferSize)),
 		"server.http",
-		// If you did not set the global propagator as shown in `tracing.go`
+		// The semantic convention http metrics are recorded by telemetry.ServerMetrics instead.
+		otelhttp.WithMeterProvider(noop.NewMeterProvider()),
+		// If you did not set the global propagator as shown in `telemetry/telemetry.go`
 		// then you need to provide this one
 		// otelhttp.WithPropagators(propagator),
 	)
 	server := &http.Server{
 		Addr:    serverPort,
-		Handler: handler,
+		Handler: debugHandler(handler, debug),
 	}
-
-	log := log.NewLogrus(ctx)
-	log.Info("serviceB listening on: ", address)
-	err := server.ListenAndServe()
-	if err != nil {
-		panic(err)
+	if creds != nil {
+		tlsConf, err := creds.ServerConfig()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConf
 	}
-}
 
-func serviceA_HttpHandler(w http.ResponseWriter, r *http.Request) {
-	ctx, span := otel.Tracer(tracerName).Start(r.Context(), "serviceA_HttpHandler")
-	defer span.End()
-
-	counter, _ := getMeter().Int64Counter(
-		"service_a_called_counter",
-		sdkmetric.WithDescription("how many time the serviceA handler has been called."),
-	)
-
-	counter.Add(
-		ctx,
-		1,
-		[]sdkmetric.AddOption{
-			sdkmetric.WithAttributes(
-				[]attribute.KeyValue{
-					attribute.String("handler_name", "serviceA_HttpHandler"),
-					attribute.Int64("req_size", r.ContentLength),
-				}...,
-			),
-		}...,
-	)
+	return serve(ctx, server, address)
+}
 
-	log := log.NewLogrus(ctx)
-	log.Info("serviceA_HttpHandler called")
+// adminServer returns the server of the admin endpoints. They are not authenticated, so they are served on their own listener;
+// address should only be reachable from the host, eg `127.0.0.1:9081`
+//
+// curl -vkL http://127.0.0.1:9081/admin/log
+func adminServer(address string) *http.Server {
+	var mux http.ServeMux
+	mux.Handle("/admin/log", log.AdminHandler())
+	return &http.Server{Addr: address, Handler: &mux}
+}
 
-	// When serviceA is called, it calls serviceB over tcp network.
-	// We should still be able to propagate traces over a tcp network.
-	cli := &http.Client{
-		Transport: otelhttp.NewTransport(
-			http.DefaultTransport,
-			// If you did not set the global propagator as shown in `tracing.go`
-			// then you need to provide this one
-			// otelhttp.WithPropagators(propagator),
-		),
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://otero_service_b:8082/serviceB", nil)
-	if err != nil {
-		panic(err)
+// serviceA_HttpHandler returns the handler of serviceA; it calls serviceB at serviceBURL, using cli.
+func serviceA_HttpHandler(cli *http.Client, serviceBURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := otel.Tracer(tracerName).Start(r.Context(), "serviceA_HttpHandler")
+		defer span.End()
+
+		log := log.New(ctx)
+		log.Info("serviceA_HttpHandler called")
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceBURL, nil)
+		if err != nil {
+			panic(err)
+		}
+		resp, err := cli.Do(req)
+		if err != nil {
+			panic(err)
+		}
+		// cli is shared by all requests, so its connections are reused once the body is closed.
+		defer resp.Body.Close()
+		log.Info("serviceA called serviceB", "resp.StatusCode", resp.StatusCode)
+
+		fmt.Fprintf(w, "hello from serviceA")
+		// response header contains, `Ot-Tracer-Spanid` & `Ot-Tracer-Traceid` headers that are added by the otel propagator.
+		// upstream services can then consume those.
+		log.Info("serviceA headers", "request.Header", r.Header, "response.Header", w.Header())
 	}
-	resp, err := cli.Do(req)
-	if err != nil {
-		panic(err)
-	}
-	log.Info("serviceA called serviceB and got resp.StatusCode: ", resp.StatusCode)
-
-	fmt.Fprintf(w, "hello from serviceA")
-	// response header contains, `Ot-Tracer-Spanid` & `Ot-Tracer-Traceid` headers that are added by the otel propagator.
-	// upstream services can then consume those.
-	log.Info("request.Header serviceA: ", r.Header)
-	log.Info("response.Header serviceA: ", w.Header())
 }
 
 func serviceB_HttpHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer(tracerName).Start(r.Context(), "serviceB_HttpHandler")
 	defer span.End()
 
-	counter, _ := getMeter().Int64Counter(
-		"serviceB_call_counter",
-		sdkmetric.WithDescription("how many time the serviceB handler has been called."),
-	)
-	counter.Add(ctx, 1)
-
-	log := log.NewLogrus(ctx)
+	log := log.New(ctx)
 	log.Info("serviceB_HttpHandler called")
 
 	answer := add(ctx, 42, 1813)
@@ -139,8 +163,7 @@ func serviceB_HttpHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "hello from serviceB: Answer is: %d", answer)
 	// response header contains, `Ot-Tracer-Spanid` & `Ot-Tracer-Traceid` headers that are added by the otel propagator.
 	// upstream services can then consume those.
-	log.Info("request.Header serviceB: ", r.Header)
-	log.Info("response.Header serviceB: ", w.Header())
+	log.Info("serviceB headers", "request.Header", r.Header, "response.Header", w.Header())
 }
 
 func add(ctx context.Context, x, y int64) int64 {
@@ -157,19 +180,10 @@ func add(ctx context.Context, x, y int64) int64 {
 	err := errors.New("oops, 99 problems")
 	span.RecordError(err, trace.WithStackTrace(true))
 
-	{ // Use different loggers.
-
-		lr := log.NewLogrus(ctx)
-		lr.Println("logrus: add called.")
-
-		lz := log.NewZerolog(ctx)
-		lz.Info().Msg("zerolog: add called.")
-
-		ls := log.NewSlog(ctx)
-		ls.Info("slog: add called. Wall with NO explicit context")
-		ls.Debug("slog: some msg", "age", 56)
-		ls.InfoContext(ctx, "slog: call with explicit context")
-	}
+	// The logging backend(logrus, zerolog or slog) is chosen via the `-log-backend` flag.
+	l := log.New(ctx)
+	l.Info("add called.", "x", x, "y", y)
+	l.Debug("some msg", "age", 56)
 
 	return x + y
 }
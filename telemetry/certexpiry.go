@@ -0,0 +1,101 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	certKindClient  = "client"
+	certKindService = "service"
+	certKindCA      = "ca"
+)
+
+var (
+	certKindKey    = attribute.Key("tls.certificate.kind")
+	certSubjectKey = attribute.Key("tls.certificate.subject")
+	certFileKey    = attribute.Key("tls.certificate.file")
+)
+
+// loadedCert is a certificate that was loaded from file.
+type loadedCert struct {
+	kind string
+	file string
+	cert *x509.Certificate
+}
+
+// certificates returns the client(or service) & CA certificates that are currently in use.
+func (s *certSource) certificates() []loadedCert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	certs := []loadedCert{}
+	if s.cert != nil && s.cert.Leaf != nil {
+		certs = append(certs, loadedCert{kind: s.certKind, file: s.conf.CertFile, cert: s.cert.Leaf})
+	}
+	for _, c := range s.caCerts {
+		certs = append(certs, loadedCert{kind: certKindCA, file: s.conf.CAFile, cert: c})
+	}
+	return certs
+}
+
+// expiryWarning returns how long before a certificate expires that warnExpiry warns about it.
+func expiryWarning(c TLSConfig) time.Duration {
+	return time.Duration(c.ExpiryWarningDays) * 24 * time.Hour
+}
+
+// warnExpiry logs a warning for each certificate that expires within the given duration.
+func (s *certSource) warnExpiry(ctx context.Context, within time.Duration) {
+	if within <= 0 {
+		return
+	}
+
+	l := log.New(ctx)
+	for _, c := range s.certificates() {
+		left := time.Until(c.cert.NotAfter)
+		if left > within {
+			continue
+		}
+		l.Warn("telemetry TLS certificate expires soon",
+			"kind", c.kind,
+			"cert_file", c.file,
+			"subject", c.cert.Subject.String(),
+			"not_after", c.cert.NotAfter,
+			"expires_in", left.Round(time.Second).String(),
+		)
+	}
+}
+
+// observeExpiry registers the `tls.certificate.expiry` gauge; the seconds until each certificate expires.
+// It is negative for a certificate that has expired.
+// Since the gauge reads the certificates on each collection, rotated certificates are picked up.
+// Each certSource, like the one of the exporters & the one of Credentials, registers its own callback on the gauge.
+func (s *certSource) observeExpiry(m metric.Meter) error {
+	gauge, err := m.Float64ObservableGauge(
+		"tls.certificate.expiry",
+		metric.WithDescription("seconds until the TLS certificates, of the exporters & of mutual TLS between services, expire."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, c := range s.certificates() {
+			o.ObserveFloat64(gauge,
+				time.Until(c.cert.NotAfter).Seconds(),
+				metric.WithAttributes(
+					certKindKey.String(c.kind),
+					certSubjectKey.String(c.cert.Subject.String()),
+					certFileKey.String(c.file),
+				),
+			)
+		}
+		return nil
+	}, gauge)
+	return err
+}
@@ -0,0 +1,141 @@
+package telemetry
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// logToFile sends the logs, for the duration of the test, to a file whose path is returned.
+func logToFile(t *testing.T) string {
+	t.Helper()
+
+	prev := log.GetConfig()
+	c := prev
+	c.Output = filepath.Join(t.TempDir(), "out.log")
+	if err := log.SetConfig(c); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+	t.Cleanup(func() { _ = log.SetConfig(prev) })
+	return c.Output
+}
+
+func readLog(t *testing.T, name string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	return string(b)
+}
+
+// gaugeValues returns the data points of the float64 gauge name, keyed by the value of the attribute key.
+func gaugeValues(t *testing.T, r sdkmetric.Reader, name string, key attribute.Key) map[string]float64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := r.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	values := map[string]float64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			g, ok := m.Data.(metricdata.Gauge[float64])
+			if m.Name != name || !ok {
+				continue
+			}
+			for _, dp := range g.DataPoints {
+				v, _ := dp.Attributes.Value(key)
+				values[v.Emit()] = dp.Value
+			}
+		}
+	}
+	return values
+}
+
+func TestExpiryWarning(t *testing.T) {
+	if got := expiryWarning(TLSConfig{ExpiryWarningDays: 30}); got != 30*24*time.Hour {
+		t.Errorf("expiryWarning(30 days) = %v", got)
+	}
+	if got := expiryWarning(TLSConfig{}); got != 0 {
+		t.Errorf("expiryWarning(0 days) = %v, want 0", got)
+	}
+}
+
+func TestWarnExpiry(t *testing.T) {
+	p := newTestPKI(t)
+	c := p.tlsConfig("client")
+	// The client certificate expires in 12 hours, the CA in 24 hours.
+	s, err := newCertSource(c, "", "")
+	if err != nil {
+		t.Fatalf("newCertSource() error = %v", err)
+	}
+
+	tests := []struct {
+		within   time.Duration
+		wantWarn []string
+	}{
+		{0, nil},
+		{time.Hour, nil},
+		{18 * time.Hour, []string{certKindClient}},
+		{30 * 24 * time.Hour, []string{certKindClient, certKindCA}},
+	}
+	for _, tt := range tests {
+		output := logToFile(t)
+		s.warnExpiry(context.Background(), tt.within)
+
+		got := readLog(t, output)
+		if n := strings.Count(got, "expires soon"); n != len(tt.wantWarn) {
+			t.Errorf("within %v: %d warnings, want %d; %s", tt.within, n, len(tt.wantWarn), got)
+		}
+		for _, kind := range tt.wantWarn {
+			if !strings.Contains(got, `"kind":"`+kind+`"`) {
+				t.Errorf("within %v: no warning for the %s certificate; %s", tt.within, kind, got)
+			}
+		}
+	}
+}
+
+func TestObserveExpiry(t *testing.T) {
+	p := newTestPKI(t)
+	c := p.tlsConfig("client")
+	s, err := newCertSource(c, "", "")
+	if err != nil {
+		t.Fatalf("newCertSource() error = %v", err)
+	}
+	r := sdkmetric.NewManualReader()
+	if err := s.observeExpiry(sdkmetric.NewMeterProvider(sdkmetric.WithReader(r)).Meter("test")); err != nil {
+		t.Fatalf("observeExpiry() error = %v", err)
+	}
+
+	near := func(got float64, want time.Duration) bool {
+		return math.Abs(got-want.Seconds()) < 60
+	}
+	got := gaugeValues(t, r, "tls.certificate.expiry", certKindKey)
+	if len(got) != 2 || !near(got[certKindClient], 12*time.Hour) || !near(got[certKindCA], 24*time.Hour) {
+		t.Errorf("tls.certificate.expiry = %v, want the client to expire in 12h & the CA in 24h", got)
+	}
+	files := gaugeValues(t, r, "tls.certificate.expiry", certFileKey)
+	if _, ok := files[c.CertFile]; !ok {
+		t.Errorf("tls.certificate.expiry has no data point for %s: %v", c.CertFile, files)
+	}
+
+	// A rotated certificate is picked up.
+	p.cert("client", time.Now().Add(48*time.Hour))
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got := gaugeValues(t, r, "tls.certificate.expiry", certKindKey); !near(got[certKindClient], 48*time.Hour) {
+		t.Errorf("tls.certificate.expiry of the rotated client certificate = %v, want 48h", got[certKindClient])
+	}
+}
@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+)
+
+// Credentials are TLS credentials that are loaded from the files of a TLSConfig.
+// Like the credentials of the exporters, they are reloaded whenever the files change.
+// They are used for mutual TLS between the services themselves.
+type Credentials struct {
+	s *certSource
+}
+
+// NewCredentials loads the credentials in the files of c, and watches them for changes until ctx is done.
+// The time until they expire is exported in the `tls.certificate.expiry` gauge, via the global MeterProvider.
+// If host is not empty, the certificate needs a SAN for it.
+// Servers are verified against c.ServerName, or if empty, against the host that the client connects to.
+// c.MutualTLS is required, since servers & clients both present a certificate.
+func NewCredentials(ctx context.Context, c TLSConfig, host string) (*Credentials, error) {
+	if !c.MutualTLS || c.Insecure {
+		return nil, errors.New("telemetry: TLS.MutualTLS is required for credentials, and TLS.Insecure cannot be set")
+	}
+	if c.CertReloadInterval <= 0 {
+		c.CertReloadInterval = DefaultTLSConfig().CertReloadInterval
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	s, err := newCertSource(c, host, c.ServerName)
+	if err != nil {
+		return nil, err
+	}
+	s.certKind = certKindService
+	if err := s.observeExpiry(otel.GetMeterProvider().Meter(instrumentationName)); err != nil {
+		return nil, err
+	}
+	s.warnExpiry(ctx, expiryWarning(c))
+	go s.watch(ctx, c.CertReloadInterval)
+
+	return &Credentials{s: s}, nil
+}
+
+// ClientConfig returns a configuration for clients; they verify the server & present their certificate.
+func (c *Credentials) ClientConfig() *tls.Config {
+	return c.s.clientConfig()
+}
+
+// ServerConfig returns a configuration for servers; they require clients to present a certificate signed by the root CA.
+func (c *Credentials) ServerConfig() (*tls.Config, error) {
+	return c.s.serverConfig()
+}
@@ -0,0 +1,95 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestServerConfigWithoutCertificate(t *testing.T) {
+	p := newTestPKI(t)
+	s, err := newCertSource(TLSConfig{CAFile: p.caFile}, "", "")
+	if err != nil {
+		t.Fatalf("newCertSource() error = %v", err)
+	}
+	if _, err := s.serverConfig(); err == nil || !strings.Contains(err.Error(), "MutualTLS") {
+		t.Errorf("serverConfig() without MutualTLS error = %v, want one about TLS.MutualTLS", err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	prev := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+	r := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(r)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newTestPKI(t)
+	newCreds := func(name, serverName string) *Credentials {
+		c := p.tlsConfig(name, name)
+		c.ServerName = serverName
+		creds, err := NewCredentials(ctx, c, name)
+		if err != nil {
+			t.Fatalf("NewCredentials(%s) error = %v", name, err)
+		}
+		return creds
+	}
+	serverCreds := newCreds("otero_service_b", "")
+	clientCreds := newCreds("otero_service_a", "otero_service_b")
+
+	serverConf, err := serverCreds.ServerConfig()
+	if err != nil {
+		t.Fatalf("ServerConfig() error = %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			t.Error("the client did not present a certificate")
+			return
+		}
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = serverConf
+	// The handshake of the client without a certificate fails, as expected.
+	srv.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(conf *tls.Config) (*http.Response, error) {
+		cli := &http.Client{Transport: &http.Transport{TLSClientConfig: conf, ForceAttemptHTTP2: true}}
+		return cli.Get(srv.URL)
+	}
+
+	resp, err := get(clientCreds.ClientConfig())
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2", resp.Proto)
+	}
+
+	// A client without a certificate is rejected.
+	noCert := clientCreds.ClientConfig()
+	noCert.GetClientCertificate = nil
+	if resp, err := get(noCert); err == nil {
+		resp.Body.Close()
+		t.Error("Get() without a client certificate succeeded")
+	}
+
+	// Both service certificates are in the expiry gauge.
+	subjects := gaugeValues(t, r, "tls.certificate.expiry", certSubjectKey)
+	kinds := gaugeValues(t, r, "tls.certificate.expiry", certKindKey)
+	if _, ok := kinds[certKindService]; !ok || len(subjects) != 3 {
+		t.Errorf("tls.certificate.expiry subjects = %v & kinds = %v, want the 2 service certificates & the CA", subjects, kinds)
+	}
+}
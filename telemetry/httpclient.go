@@ -0,0 +1,309 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorTypeKey is the `error.type` attribute of the semantic conventions; it is not in semconv v1.21.0
+var errorTypeKey = attribute.Key("error.type")
+
+// ClientMetrics returns a http.RoundTripper that records the `http.client.request.duration` metric of the OTel semantic conventions;
+// the time from the start of a request until its response headers are received.
+// See: https://opentelemetry.io/docs/specs/semconv/http/http-metrics/#http-client
+//
+// The metric is tagged with the method, the server address & port, the scheme and the status code; or `error.type` if the request failed.
+// It should be wrapped by the otelhttp transport, so that the metric is recorded in the context of the request's span:
+//
+//	otelhttp.NewTransport(telemetry.ClientMetrics(http.DefaultTransport))
+func ClientMetrics(next http.RoundTripper) http.RoundTripper {
+	duration, err := otel.GetMeterProvider().Meter(instrumentationName).Float64Histogram(
+		"http.client.request.duration",
+		metric.WithDescription("duration of HTTP client requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(r)
+
+		attrs := []attribute.KeyValue{httpMethod(r.Method), semconv.URLSchemeKey.String(r.URL.Scheme)}
+		host, port := r.URL.Hostname(), r.URL.Port()
+		if port == "" {
+			port = "80"
+			if r.URL.Scheme == "https" {
+				port = "443"
+			}
+		}
+		attrs = append(attrs, semconv.ServerAddressKey.String(host))
+		if p, pErr := strconv.Atoi(port); pErr == nil {
+			attrs = append(attrs, semconv.ServerPortKey.Int(p))
+		}
+		if err != nil {
+			attrs = append(attrs, errorTypeKey.String(fmt.Sprintf("%T", err)))
+		} else {
+			attrs = append(attrs, semconv.HTTPResponseStatusCodeKey.Int(resp.StatusCode))
+		}
+		duration.Record(r.Context(), time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+
+		return resp, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// ClientTraceMode is how the phases of outbound requests are traced; see ClientTrace.
+type ClientTraceMode string
+
+const (
+	// ClientTraceOff does not trace the phases of requests.
+	ClientTraceOff ClientTraceMode = "off"
+	// ClientTraceEvents records the phases of requests as events of the client span.
+	ClientTraceEvents ClientTraceMode = "events"
+	// ClientTraceSpans records the phases of requests as child spans of the client span.
+	ClientTraceSpans ClientTraceMode = "spans"
+)
+
+// ParseClientTraceMode returns the ClientTraceMode named s; off, events or spans.
+func ParseClientTraceMode(s string) (ClientTraceMode, error) {
+	switch m := ClientTraceMode(s); m {
+	case ClientTraceOff, ClientTraceEvents, ClientTraceSpans:
+		return m, nil
+	case "":
+		return ClientTraceOff, nil
+	default:
+		return "", fmt.Errorf("telemetry: invalid client trace mode %q; valid ones are off, events & spans", s)
+	}
+}
+
+// ClientTrace returns a http.RoundTripper that traces the phases of the requests made with next, using net/http/httptrace;
+// the DNS lookup, the connect, the TLS handshake & the wait for the first byte of the response(ie, server time).
+// Whether the connection was reused is recorded as an attribute of the client span.
+// eg, a slow request whose time is mostly spent in `http.wait_first_byte` was slow in the server, rather than in `http.connect` or `http.tls`.
+//
+// Phases that have not ended by the time that next returns, eg the wait for the first byte of a request that failed, are ended with an error status.
+// It returns next for ClientTraceOff. It should be wrapped by the otelhttp transport, so that the phases are traced in the request's span:
+//
+//	otelhttp.NewTransport(telemetry.ClientTrace(http.DefaultTransport, telemetry.ClientTraceSpans))
+func ClientTrace(next http.RoundTripper, mode ClientTraceMode) http.RoundTripper {
+	if mode != ClientTraceEvents && mode != ClientTraceSpans {
+		return next
+	}
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		ctx := r.Context()
+		t := &clientTracer{
+			ctx:    ctx,
+			span:   trace.SpanFromContext(ctx),
+			spans:  mode == ClientTraceSpans,
+			starts: map[string]time.Time{},
+			active: map[string]trace.Span{},
+		}
+		resp, err := next.RoundTrip(r.WithContext(httptrace.WithClientTrace(ctx, t.clientTrace())))
+		t.finish(err)
+		return resp, err
+	})
+}
+
+var (
+	// errPhaseUnfinished ends the phases that were still pending when a request returned without an error.
+	errPhaseUnfinished = errors.New("telemetry: the request returned before the phase ended")
+	// errPhaseRestarted ends a phase that started again before it ended; eg, the request was written again after a retry.
+	errPhaseRestarted = errors.New("telemetry: the phase started again before it ended")
+)
+
+// clientTracer traces the phases of a request. The phases are named by the keys of starts & active.
+// Its methods are called from the goroutines of the http.Transport, so they are guarded by mu.
+type clientTracer struct {
+	ctx   context.Context
+	span  trace.Span
+	spans bool
+
+	mu     sync.Mutex
+	starts map[string]time.Time
+	// active are the child spans of phases that have started but not ended; if spans is set.
+	active map[string]trace.Span
+	// done is set once the request has returned; phases that start after it are not traced.
+	// The http.Transport may, for instance, keep dialing a connection for its pool.
+	done bool
+}
+
+func (t *clientTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.start("http.get_conn", hostPortAttrs(semconv.ServerAddressKey, semconv.ServerPortKey, hostPort)...)
+		},
+		GotConn: t.gotConn,
+		DNSStart: func(i httptrace.DNSStartInfo) {
+			t.start("http.dns", semconv.ServerAddressKey.String(i.Host))
+		},
+		DNSDone: func(i httptrace.DNSDoneInfo) {
+			addrs := make([]string, 0, len(i.Addrs))
+			for _, a := range i.Addrs {
+				addrs = append(addrs, a.String())
+			}
+			t.end("http.dns", i.Err, attribute.StringSlice("net.dns.addrs", addrs))
+		},
+		ConnectStart: func(network, addr string) {
+			// A connect may be attempted to many addresses at once; see net.Dialer.FallbackDelay
+			attrs := append(hostPortAttrs(networkPeerAddressKey, networkPeerPortKey, addr), attribute.String("network.transport", network))
+			t.start("http.connect:"+addr, attrs...)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.end("http.connect:"+addr, err)
+		},
+		TLSHandshakeStart: func() {
+			t.start("http.tls")
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			t.end("http.tls", err,
+				attribute.String("tls.protocol.version", strings.TrimPrefix(tls.VersionName(cs.Version), "TLS ")),
+				attribute.Bool("tls.resumed", cs.DidResume),
+			)
+		},
+		WroteRequest: func(i httptrace.WroteRequestInfo) {
+			if i.Err != nil {
+				t.event("http.wrote_request", attribute.String("error", i.Err.Error()))
+			}
+			// The time from here to the first byte is mostly the time that the server takes.
+			t.start("http.wait_first_byte")
+		},
+		GotFirstResponseByte: func() {
+			t.end("http.wait_first_byte", nil)
+		},
+	}
+}
+
+var (
+	networkPeerAddressKey = attribute.Key("network.peer.address")
+	networkPeerPortKey    = attribute.Key("network.peer.port")
+)
+
+// hostPortAttrs returns the attributes hostKey & portKey of the address hostPort; eg, `10.0.0.1:80`
+// If hostPort has no port, it is all the host.
+func hostPortAttrs(hostKey, portKey attribute.Key, hostPort string) []attribute.KeyValue {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return []attribute.KeyValue{hostKey.String(hostPort)}
+	}
+	attrs := []attribute.KeyValue{hostKey.String(host)}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, portKey.Int(p))
+	}
+	return attrs
+}
+
+// phaseName returns the name of the phase p; eg, `http.connect:10.0.0.1:80` is named `http.connect`
+func phaseName(p string) string {
+	name, _, _ := strings.Cut(p, ":")
+	return name
+}
+
+func (t *clientTracer) start(phase string, attrs ...attribute.KeyValue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return
+	}
+	t.endLocked(phase, errPhaseRestarted)
+
+	t.starts[phase] = time.Now()
+	if t.spans {
+		_, s := otel.Tracer(instrumentationName).Start(t.ctx, phaseName(phase), trace.WithAttributes(attrs...))
+		t.active[phase] = s
+		return
+	}
+	t.span.AddEvent(phaseName(phase)+".start", trace.WithAttributes(attrs...))
+}
+
+func (t *clientTracer) end(phase string, err error, attrs ...attribute.KeyValue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.endLocked(phase, err, attrs...)
+}
+
+// endLocked ends phase, if it has started. t.mu must be held.
+func (t *clientTracer) endLocked(phase string, err error, attrs ...attribute.KeyValue) {
+	start, ok := t.starts[phase]
+	if !ok {
+		return
+	}
+	delete(t.starts, phase)
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+
+	if t.spans {
+		s := t.active[phase]
+		delete(t.active, phase)
+		s.SetAttributes(attrs...)
+		if err != nil {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, err.Error())
+		}
+		s.End()
+		return
+	}
+	attrs = append(attrs, attribute.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000))
+	t.span.AddEvent(phaseName(phase)+".done", trace.WithAttributes(attrs...))
+}
+
+// finish ends the phases that are still pending once the request has returned with err; eg, the wait for the first byte of a failed request.
+// Their spans would otherwise never end.
+func (t *clientTracer) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err == nil {
+		err = errPhaseUnfinished
+	}
+	for phase := range t.starts {
+		t.endLocked(phase, err)
+	}
+	t.done = true
+}
+
+func (t *clientTracer) event(name string, attrs ...attribute.KeyValue) {
+	t.span.AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+func (t *clientTracer) gotConn(i httptrace.GotConnInfo) {
+	attrs := []attribute.KeyValue{
+		attribute.Bool("http.conn.reused", i.Reused),
+		attribute.Bool("http.conn.was_idle", i.WasIdle),
+	}
+	if i.WasIdle {
+		attrs = append(attrs, attribute.String("http.conn.idle_time", i.IdleTime.String()))
+	}
+	if i.Conn != nil {
+		attrs = append(attrs, hostPortAttrs(networkPeerAddressKey, networkPeerPortKey, i.Conn.RemoteAddr().String())...)
+	}
+	t.span.SetAttributes(attrs...)
+	t.end("http.get_conn", nil, attrs...)
+}
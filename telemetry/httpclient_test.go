@@ -0,0 +1,274 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setTracerProvider sets, for the duration of the test, a global TracerProvider that samples all spans into the returned recorder.
+// The log.SpanProcessor is also registered, as it is by Setup.
+func setTracerProvider(t *testing.T) (trace.Tracer, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	prev := otel.GetTracerProvider()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSpanProcessor(log.SpanProcessor()),
+		sdktrace.WithSpanProcessor(rec),
+	)
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+	})
+	return tp.Tracer("test"), rec
+}
+
+func TestParseClientTraceMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ClientTraceMode
+		wantErr bool
+	}{
+		{"", ClientTraceOff, false},
+		{"off", ClientTraceOff, false},
+		{"events", ClientTraceEvents, false},
+		{"spans", ClientTraceSpans, false},
+		{"Spans", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClientTraceMode(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseClientTraceMode(%q) = %q, %v; want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHostPortAttrs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []attribute.KeyValue
+	}{
+		{"10.0.0.1:80", []attribute.KeyValue{networkPeerAddressKey.String("10.0.0.1"), networkPeerPortKey.Int(80)}},
+		{"[::1]:8082", []attribute.KeyValue{networkPeerAddressKey.String("::1"), networkPeerPortKey.Int(8082)}},
+		{"otero_service_b:http", []attribute.KeyValue{networkPeerAddressKey.String("otero_service_b")}},
+		{"otero_service_b", []attribute.KeyValue{networkPeerAddressKey.String("otero_service_b")}},
+	}
+	for _, tt := range tests {
+		got := attribute.NewSet(hostPortAttrs(networkPeerAddressKey, networkPeerPortKey, tt.in)...)
+		if want := attribute.NewSet(tt.want...); !got.Equals(&want) {
+			t.Errorf("hostPortAttrs(%q) = %v, want %v", tt.in, got.ToSlice(), tt.want)
+		}
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	reader := setMeterProvider(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cli := &http.Client{Transport: ClientMetrics(http.DefaultTransport)}
+	resp, err := cli.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if _, err := cli.Get("http://127.0.0.1:1"); err == nil {
+		t.Fatal("Get() of a closed port succeeded")
+	}
+
+	duration, ok := collect(t, reader, "http.client.request.duration").(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 2 {
+		t.Fatalf("http.client.request.duration = %+v, want 2 data points", duration)
+	}
+	got := map[string]bool{}
+	for _, dp := range duration.DataPoints {
+		got[attrsString(dp.Attributes)] = true
+	}
+	for _, want := range []string{
+		"http.request.method=GET,http.response.status_code=202,server.address=127.0.0.1,server.port=" + srv.URL[len("http://127.0.0.1:"):] + ",url.scheme=http",
+		"error.type=*net.OpError,http.request.method=GET,server.address=127.0.0.1,server.port=1,url.scheme=http",
+	} {
+		if !got[want] {
+			t.Errorf("http.client.request.duration has no data point %s; %v", want, got)
+		}
+	}
+}
+
+// spanErrors returns the ended spans of rec keyed by name, each with its error status description; or "" if it did not fail.
+func spanErrors(rec *tracetest.SpanRecorder) map[string][]string {
+	got := map[string][]string{}
+	for _, s := range rec.Ended() {
+		desc := ""
+		if s.Status().Code == codes.Error {
+			desc = s.Status().Description
+		}
+		got[s.Name()] = append(got[s.Name()], desc)
+	}
+	return got
+}
+
+func TestClientTraceSpans(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/abort":
+			// The connection is closed without a response.
+			panic(http.ErrAbortHandler)
+		case "/retry":
+			// The first call closes the reused connection, so the transport retries the request on a new one.
+			if calls.Add(1) == 1 {
+				panic(http.ErrAbortHandler)
+			}
+		}
+	}))
+	// The aborted handlers are logged by the server.
+	srv.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		// keepAlive reuses the connection of a previous request.
+		keepAlive bool
+		wantErr   bool
+		// want are the error status descriptions of the phase spans, by name.
+		want map[string][]string
+	}{
+		{
+			name: "ok",
+			url:  srv.URL,
+			want: map[string][]string{"http.get_conn": {""}, "http.connect": {""}, "http.wait_first_byte": {""}},
+		},
+		{
+			name:    "dial fails",
+			url:     "http://127.0.0.1:1",
+			wantErr: true,
+			want: map[string][]string{
+				"http.get_conn": {"dial tcp 127.0.0.1:1: connect: connection refused"},
+				"http.connect":  {"dial tcp 127.0.0.1:1: connect: connection refused"},
+			},
+		},
+		{
+			name:    "no response",
+			url:     srv.URL + "/abort",
+			wantErr: true,
+			want: map[string][]string{
+				"http.get_conn":        {""},
+				"http.connect":         {""},
+				"http.wait_first_byte": {"EOF"},
+			},
+		},
+		{
+			name:      "retried",
+			url:       srv.URL + "/retry",
+			keepAlive: true,
+			want: map[string][]string{
+				"http.get_conn":        {"", ""},
+				"http.connect":         {""},
+				"http.wait_first_byte": {errPhaseRestarted.Error(), ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &http.Transport{}
+			defer transport.CloseIdleConnections()
+			if tt.keepAlive {
+				resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, srv.URL, nil).WithContext(context.Background()))
+				if err != nil {
+					t.Fatalf("RoundTrip() error = %v", err)
+				}
+				resp.Body.Close()
+			}
+			tracer, rec := setTracerProvider(t)
+			ctx, buf := log.NewBufferContext(context.Background(), 10)
+			ctx, span := tracer.Start(ctx, "client")
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, tt.url, nil)
+			resp, err := ClientTrace(transport, ClientTraceSpans).RoundTrip(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RoundTrip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+			span.End()
+
+			// Every span has ended, so none of them is left in the span buffers of the log package.
+			if started, ended := len(rec.Started()), len(rec.Ended()); started != ended {
+				t.Errorf("%d spans started but %d ended", started, ended)
+			}
+			got := spanErrors(rec)
+			delete(got, "client")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("phase spans = %q, want %q", got, tt.want)
+			}
+			// A phase that ended with an error fails the Buffer of the request; which is released once the span ends.
+			failed := false
+			for _, errs := range tt.want {
+				failed = failed || slices.ContainsFunc(errs, func(e string) bool { return e != "" })
+			}
+			if buf.Failed() != failed {
+				t.Errorf("Buffer.Failed() = %v, want %v", buf.Failed(), failed)
+			}
+		})
+	}
+}
+
+func TestClientTraceEvents(t *testing.T) {
+	tracer, rec := setTracerProvider(t)
+
+	ctx, span := tracer.Start(context.Background(), "client")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:1", nil)
+	if _, err := ClientTrace(&http.Transport{}, ClientTraceEvents).RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() of a closed port succeeded")
+	}
+	span.End()
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want only the client span", len(spans))
+	}
+	events := map[string]attribute.Set{}
+	for _, e := range spans[0].Events() {
+		events[e.Name] = attribute.NewSet(e.Attributes...)
+	}
+	for _, name := range []string{"http.get_conn.start", "http.connect.start", "http.connect.done", "http.get_conn.done"} {
+		if _, ok := events[name]; !ok {
+			t.Errorf("no %s event; %v", name, spans[0].Events())
+		}
+	}
+	done := events["http.get_conn.done"]
+	if _, ok := done.Value("error"); !ok {
+		t.Errorf("http.get_conn.done attributes = %v, want an error", done.ToSlice())
+	}
+	start := events["http.connect.start"]
+	if v, _ := start.Value(networkPeerPortKey); v.AsInt64() != 1 {
+		t.Errorf("http.connect.start attributes = %v, want network.peer.port 1", start.ToSlice())
+	}
+
+	// The requests are not traced when off.
+	transport := &http.Transport{}
+	if got := ClientTrace(transport, ClientTraceOff); got != http.RoundTripper(transport) {
+		t.Errorf("ClientTrace(off) = %v, want the transport", got)
+	}
+}
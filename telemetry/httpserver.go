@@ -0,0 +1,167 @@
+package telemetry
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// durationBuckets are the bucket boundaries, in seconds, of the `http.*.request.duration` histograms; as recommended by the semantic conventions.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// sizeBuckets are the bucket boundaries, in bytes, of the body size histograms.
+var sizeBuckets = []float64{0, 100, 1_000, 10_000, 100_000, 1_000_000, 10_000_000}
+
+// ServerMetrics returns a http.Handler that serves mux, and records the HTTP server metrics of the OTel semantic conventions;
+// `http.server.request.duration`, `http.server.active_requests`, `http.server.request.body.size` & `http.server.response.body.size`
+// See: https://opentelemetry.io/docs/specs/semconv/http/http-metrics/#http-server
+//
+// The metrics are tagged with the method, the route(the pattern of mux that matched the request), the status code & the scheme.
+// The route is used instead of the path, so that the number of time series is bounded.
+//
+// It should wrap mux inside of the otelhttp handler, so that the metrics are recorded in the context of the request's span:
+//
+//	handler := otelhttp.NewHandler(telemetry.ServerMetrics(mux), "server.http")
+func ServerMetrics(mux *http.ServeMux) http.Handler {
+	meter := otel.GetMeterProvider().Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("duration of HTTP server requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	active, err := meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("number of active HTTP server requests."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	requestSize, err := meter.Int64Histogram(
+		"http.server.request.body.size",
+		metric.WithDescription("size of HTTP server request bodies."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(sizeBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	responseSize, err := meter.Int64Histogram(
+		"http.server.response.body.size",
+		metric.WithDescription("size of HTTP server response bodies."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(sizeBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := r.Context()
+
+		attrs := []attribute.KeyValue{httpMethod(r.Method), urlScheme(r)}
+		// The span is left out of the context of active_requests, so that it has no exemplars;
+		// they are meaningless for a gauge, and prometheus does not allow them.
+		noSpanCtx := trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+		active.Add(noSpanCtx, 1, metric.WithAttributes(attrs...))
+		defer active.Add(noSpanCtx, -1, metric.WithAttributes(attrs...))
+
+		_, route := mux.Handler(r)
+		if route != "" {
+			attrs = append(attrs, semconv.HTTPRouteKey.String(route))
+			trace.SpanFromContext(ctx).SetAttributes(semconv.HTTPRouteKey.String(route))
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		mw := &metricsWriter{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			attrs = append(attrs, semconv.HTTPResponseStatusCodeKey.Int(mw.status))
+			opt := metric.WithAttributes(attrs...)
+
+			duration.Record(ctx, time.Since(start).Seconds(), opt)
+			reqSize := r.ContentLength
+			if reqSize < 0 {
+				// The size is not known upfront, eg; a chunked body.
+				reqSize = body.n.Load()
+			}
+			requestSize.Record(ctx, reqSize, opt)
+			responseSize.Record(ctx, mw.written, opt)
+		}()
+
+		mux.ServeHTTP(mw, r)
+	})
+}
+
+// httpMethod returns the `http.request.method` of method.
+// Methods that are not known are reported as `_OTHER`, so that the number of time series is bounded.
+func httpMethod(method string) attribute.KeyValue {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return semconv.HTTPRequestMethodKey.String(method)
+	default:
+		return semconv.HTTPRequestMethodOther
+	}
+}
+
+func urlScheme(r *http.Request) attribute.KeyValue {
+	if r.TLS != nil {
+		return semconv.URLSchemeKey.String("https")
+	}
+	return semconv.URLSchemeKey.String("http")
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// metricsWriter records the status code & the size of a response.
+type metricsWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+func (m *metricsWriter) WriteHeader(code int) {
+	if !m.wroteHeader {
+		m.status, m.wroteHeader = code, true
+	}
+	m.ResponseWriter.WriteHeader(code)
+}
+
+func (m *metricsWriter) Write(p []byte) (int, error) {
+	m.wroteHeader = true
+	n, err := m.ResponseWriter.Write(p)
+	m.written += int64(n)
+	return n, err
+}
+
+func (m *metricsWriter) Unwrap() http.ResponseWriter {
+	return m.ResponseWriter
+}
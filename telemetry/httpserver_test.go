@@ -0,0 +1,164 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// setMeterProvider sets, for the duration of the test, a global MeterProvider whose metrics are collected by the returned reader.
+func setMeterProvider(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+
+	prev := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+	r := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(r)))
+	return r
+}
+
+func collect(t *testing.T, r sdkmetric.Reader, name string) metricdata.Aggregation {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := r.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
+// attrsString formats a set of attributes as `k=v,k=v`, sorted by key, for comparisons.
+func attrsString(s attribute.Set) string {
+	parts := []string{}
+	for _, kv := range s.ToSlice() {
+		parts = append(parts, string(kv.Key)+"="+kv.Value.Emit())
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestServerMetrics(t *testing.T) {
+	reader := setMeterProvider(t)
+
+	inFlight := make(chan int64, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/active", func(w http.ResponseWriter, r *http.Request) {
+		sum, _ := collect(t, reader, "http.server.active_requests").(metricdata.Sum[int64])
+		var n int64
+		for _, dp := range sum.DataPoints {
+			n += dp.Value
+		}
+		inFlight <- n
+	})
+	h := ServerMetrics(mux)
+
+	serve := func(method, target string, body io.Reader) {
+		req := httptest.NewRequest(method, target, body)
+		if body != nil {
+			// The size of a chunked body is only known once it is read.
+			req.ContentLength = -1
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve(http.MethodGet, "/users/42", nil)
+	serve(http.MethodGet, "/users/43", nil)
+	serve(http.MethodPost, "/users/", strings.NewReader("abc"))
+	serve("PURGE", "/users/1", nil)
+	serve(http.MethodGet, "/missing", nil)
+	serve(http.MethodGet, "/active", nil)
+
+	if n := <-inFlight; n != 1 {
+		t.Errorf("http.server.active_requests during a request = %d, want 1", n)
+	}
+
+	duration, ok := collect(t, reader, "http.server.request.duration").(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatal("no http.server.request.duration histogram")
+	}
+	counts := map[string]uint64{}
+	for _, dp := range duration.DataPoints {
+		counts[attrsString(dp.Attributes)] = dp.Count
+	}
+	want := map[string]uint64{
+		"http.request.method=GET,http.response.status_code=200,http.route=/users/,url.scheme=http":    2,
+		"http.request.method=POST,http.response.status_code=201,http.route=/users/,url.scheme=http":   1,
+		"http.request.method=_OTHER,http.response.status_code=200,http.route=/users/,url.scheme=http": 1,
+		// An unmatched request has no route.
+		"http.request.method=GET,http.response.status_code=404,url.scheme=http":                    1,
+		"http.request.method=GET,http.response.status_code=200,http.route=/active,url.scheme=http": 1,
+	}
+	for k, v := range want {
+		if counts[k] != v {
+			t.Errorf("http.server.request.duration count of %s = %d, want %d", k, counts[k], v)
+		}
+	}
+	if len(counts) != len(want) {
+		t.Errorf("http.server.request.duration data points = %v", counts)
+	}
+
+	sizes := func(name string) map[string]int64 {
+		h, ok := collect(t, reader, name).(metricdata.Histogram[int64])
+		if !ok {
+			t.Fatalf("no %s histogram", name)
+		}
+		sums := map[string]int64{}
+		for _, dp := range h.DataPoints {
+			method, _ := dp.Attributes.Value(semconv.HTTPRequestMethodKey)
+			sums[method.AsString()] += dp.Sum
+		}
+		return sums
+	}
+	if got := sizes("http.server.request.body.size"); got[http.MethodPost] != 3 {
+		t.Errorf("http.server.request.body.size of POST = %d, want 3", got[http.MethodPost])
+	}
+	if got := sizes("http.server.response.body.size"); got["_OTHER"] != 5 {
+		t.Errorf("http.server.response.body.size of _OTHER = %d, want 5", got["_OTHER"])
+	}
+
+	sum, _ := collect(t, reader, "http.server.active_requests").(metricdata.Sum[int64])
+	for _, dp := range sum.DataPoints {
+		if dp.Value != 0 {
+			t.Errorf("http.server.active_requests{%s} = %d after the requests, want 0", attrsString(dp.Attributes), dp.Value)
+		}
+	}
+}
+
+func TestMetricsWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	mw := &metricsWriter{ResponseWriter: rec, status: http.StatusOK}
+	mw.WriteHeader(http.StatusTeapot)
+	// Only the first status code is sent.
+	mw.WriteHeader(http.StatusInternalServerError)
+	_, _ = mw.Write([]byte("short"))
+	_, _ = mw.Write([]byte(" and stout"))
+
+	if mw.status != http.StatusTeapot || mw.written != 15 {
+		t.Errorf("status = %d & written = %d, want %d & 15", mw.status, mw.written, http.StatusTeapot)
+	}
+	if http.NewResponseController(mw).Flush() != nil {
+		t.Error("Flush() through Unwrap failed")
+	}
+}
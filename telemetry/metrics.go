@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// promRegistry is the registry that MetricsHandler serves; it is nil unless Config.Prometheus is set.
+var promRegistry atomic.Pointer[prometheus.Registry]
+
+func setupMetrics(ctx context.Context, c Config, res *resource.Resource, certs *certSource) (*sdkmetric.MeterProvider, error) {
+	/*
+		Alternative ways of providing an exporter:
+
+		(a)
+		import "go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+		exporter, err := stdoutmetric.New()
+
+		(b)
+		Prometheus; see Config.Prometheus
+	*/
+
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(c.Endpoint)}
+	if certs == nil {
+		// TLSConfig.Insecure; only for local development.
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(certs.clientConfig())))
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	providerOpts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(
+			sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(c.MetricsInterval)),
+		),
+
+		// sdkmetric.WithView(sdkmetric.NewView(
+		// 	sdkmetric.Instrument{Name: "some_latency"},
+		// 	sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{
+		// 		// this floats define the distribution bucket boundaries for the histogram of `some_latency` metric
+		// 		// Bucket boundaries are 10ms, 100ms, 1s, 10s, 30s and 60s.
+		// 		Boundaries: []float64{10, 100, 1000, 10000, 30000, 60000},
+		// 	}},
+		// )),
+	}
+
+	if c.Prometheus {
+		// The prometheus exporter is a pull based reader; it collects the metrics whenever /metrics is scraped.
+		// It is in addition to the OTLP reader, so services can be scraped directly when there is no collector.
+		reg := prometheus.NewRegistry()
+		promExporter, err := otelprometheus.New(
+			// The resource is exported as the `target_info` metric, which is the default.
+			otelprometheus.WithRegisterer(reg),
+		)
+		if err != nil {
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdkmetric.WithReader(promExporter))
+		promRegistry.Store(reg)
+	} else {
+		promRegistry.Store(nil)
+	}
+
+	mp := sdkmetric.NewMeterProvider(providerOpts...)
+	otel.SetMeterProvider(mp)
+
+	return mp, nil
+}
+
+// MetricsHandler returns a http.Handler that serves the metrics in the prometheus format, for scraping.
+// It negotiates the OpenMetrics format with scrapers that ask for it; which is needed for exemplars to be served.
+// The resource(service name, version etc) is served as the `target_info` metric.
+//
+// It returns nil, unless Setup was called with Config.Prometheus set.
+//
+// usage:
+//
+//	if h := telemetry.MetricsHandler(); h != nil {
+//		mux.Handle("/metrics", h)
+//	}
+func MetricsHandler() http.Handler {
+	reg := promRegistry.Load()
+	if reg == nil {
+		return nil
+	}
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		// Errors are handled by the ErrorHandler of the OTel SDK, which logs & counts them.
+		ErrorHandling: promhttp.ContinueOnError,
+		ErrorLog:      promErrorLog{},
+	})
+}
+
+// promErrorLog routes the errors of promhttp to the otel error handler.
+type promErrorLog struct{}
+
+func (promErrorLog) Println(v ...any) {
+	otel.Handle(fmt.Errorf("prometheus metrics handler: %s", fmt.Sprint(v...)))
+}
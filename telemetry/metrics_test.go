@@ -0,0 +1,90 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// scrape records a measurement in the context of a sampled span, then scrapes MetricsHandler with the accept header.
+// It returns the content type & the body of the response.
+func scrape(t *testing.T, accept string) (string, string) {
+	t.Helper()
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "request")
+	h, err := otel.Meter("test").Float64Histogram("test.duration")
+	if err != nil {
+		t.Fatalf("Float64Histogram() error = %v", err)
+	}
+	h.Record(ctx, 0.5)
+	span.End()
+
+	handler := MetricsHandler()
+	if handler == nil {
+		t.Fatal("MetricsHandler() = nil, with Config.Prometheus set")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	const openMetrics = "application/openmetrics-text"
+
+	tests := []struct {
+		name          string
+		exemplarEnv   string
+		accept        string
+		wantType      string
+		wantExemplars bool
+	}{
+		{"openmetrics with exemplars", "true", openMetrics, openMetrics, true},
+		// The SDK only records exemplars when the operator turns them on.
+		{"openmetrics without exemplars", "", openMetrics, openMetrics, false},
+		{"text format", "true", "", "text/plain", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_GO_X_EXEMPLAR", tt.exemplarEnv)
+			c := insecureConfig(t)
+			c.Prometheus = true
+			c.Sampler = sdktrace.AlwaysSample()
+			setup(t, c)
+
+			contentType, body := scrape(t, tt.accept)
+			if !strings.HasPrefix(contentType, tt.wantType) {
+				t.Errorf("Content-Type = %s, want %s", contentType, tt.wantType)
+			}
+			if !strings.Contains(body, "test_duration") || !strings.Contains(body, `target_info{`) || !strings.Contains(body, `service_name="svc"`) {
+				t.Errorf("GET /metrics has no test_duration or target_info; %s", body)
+			}
+			if got := strings.Contains(body, "trace_id="); got != tt.wantExemplars {
+				t.Errorf("GET /metrics has exemplars = %v, want %v; %s", got, tt.wantExemplars, body)
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerWithoutPrometheus(t *testing.T) {
+	c := insecureConfig(t)
+	c.Prometheus = true
+	setup(t, c)
+
+	c = insecureConfig(t)
+	setup(t, c)
+	if h := MetricsHandler(); h != nil {
+		t.Error("MetricsHandler() != nil, without Config.Prometheus")
+	}
+}
@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// clockTicks is the number of clock ticks per second, that /proc reports CPU time in.
+// It is USER_HZ, which is 100 on all the architectures that Linux supports.
+const clockTicks = 100
+
+var cpuModeKey = attribute.Key("cpu.mode")
+
+// registerProcessMetrics registers the metrics of this process, read from /proc/self/stat & /proc/self/fd, with m.
+// They follow the `process.*` metrics of the OTel semantic conventions; see https://opentelemetry.io/docs/specs/semconv/system/process-metrics/
+// On systems without /proc, no metrics are registered.
+func registerProcessMetrics(ctx context.Context, m metric.Meter) error {
+	if _, err := readProcStat(); err != nil {
+		log.New(ctx).Debug("process metrics are not available", "error", err)
+		return nil
+	}
+
+	cpuTime, err := m.Float64ObservableCounter("process.cpu.time",
+		metric.WithDescription("total CPU seconds broken down by mode."), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	memUsage, err := m.Int64ObservableUpDownCounter("process.memory.usage",
+		metric.WithDescription("the amount of physical memory in use; RSS."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	memVirtual, err := m.Int64ObservableUpDownCounter("process.memory.virtual",
+		metric.WithDescription("the amount of committed virtual memory."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	fds, err := m.Int64ObservableUpDownCounter("process.open_file_descriptor.count",
+		metric.WithDescription("number of file descriptors in use by the process."), metric.WithUnit("{count}"))
+	if err != nil {
+		return err
+	}
+	threads, err := m.Int64ObservableUpDownCounter("process.thread.count",
+		metric.WithDescription("process threads count."), metric.WithUnit("{thread}"))
+	if err != nil {
+		return err
+	}
+
+	_, err = m.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			st, err := readProcStat()
+			if err != nil {
+				return err
+			}
+			o.ObserveFloat64(cpuTime, st.userTime, metric.WithAttributes(cpuModeKey.String("user")))
+			o.ObserveFloat64(cpuTime, st.systemTime, metric.WithAttributes(cpuModeKey.String("system")))
+			o.ObserveInt64(memUsage, st.rss)
+			o.ObserveInt64(memVirtual, st.vsize)
+			o.ObserveInt64(threads, st.threads)
+
+			n, err := openFDs()
+			if err != nil {
+				return err
+			}
+			o.ObserveInt64(fds, n)
+			return nil
+		},
+		cpuTime, memUsage, memVirtual, fds, threads,
+	)
+	return err
+}
+
+// procStat is the subset of /proc/self/stat that is exported; see proc(5)
+type procStat struct {
+	userTime   float64 // seconds
+	systemTime float64 // seconds
+	threads    int64
+	vsize      int64 // bytes
+	rss        int64 // bytes
+}
+
+func readProcStat() (procStat, error) {
+	b, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return procStat{}, err
+	}
+	return parseProcStat(b, os.Getpagesize())
+}
+
+// parseProcStat parses b, the contents of /proc/self/stat. The rss is reported in pages of pageSize bytes.
+func parseProcStat(b []byte, pageSize int) (procStat, error) {
+	var st procStat
+
+	// The second field is the name of the executable in parentheses, and it may contain spaces.
+	// So the fields are counted from after its closing parenthesis; the first of them is the third field, `state`.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return st, fmt.Errorf("telemetry: malformed /proc/self/stat: %q", b)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 22 {
+		return st, fmt.Errorf("telemetry: malformed /proc/self/stat: %q", b)
+	}
+	field := func(n int) int64 {
+		v, _ := strconv.ParseInt(fields[n-3], 10, 64)
+		return v
+	}
+
+	st.userTime = float64(field(14)) / clockTicks
+	st.systemTime = float64(field(15)) / clockTicks
+	st.threads = field(20)
+	st.vsize = field(23)
+	st.rss = field(24) * int64(pageSize)
+	return st, nil
+}
+
+// openFDs returns the number of open file descriptors of this process.
+func openFDs() (int64, error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	// One of them is the descriptor used to read the directory itself.
+	return int64(len(entries) - 1), nil
+}
@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    procStat
+		wantErr bool
+	}{
+		{
+			name: "stat",
+			in:   "1234 (otero) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 75 0 0 20 0 7 0 12345 104857600 2560 18446744073709551615 1 1 0 0 0 0 0 0 0\n",
+			want: procStat{userTime: 2.5, systemTime: 0.75, threads: 7, vsize: 104857600, rss: 2560 * 4096},
+		},
+		{
+			name: "name with spaces & parentheses",
+			in:   "1234 (my (odd) name) R 1 1234 1234 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 3 0 12345 4096 1 0",
+			want: procStat{userTime: 0.01, systemTime: 0.02, threads: 3, vsize: 4096, rss: 4096},
+		},
+		{name: "no name", in: "1234 otero S 1 1234", wantErr: true},
+		{name: "too few fields", in: "1234 (otero) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 75", wantErr: true},
+		{name: "empty", in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseProcStat([]byte(tt.in), 4096)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseProcStat() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: parseProcStat() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc on this system")
+	}
+
+	st, err := readProcStat()
+	if err != nil {
+		t.Fatalf("readProcStat() error = %v", err)
+	}
+	if st.threads < 1 || st.rss <= 0 || st.vsize < st.rss {
+		t.Errorf("readProcStat() = %+v", st)
+	}
+	if n, err := openFDs(); err != nil || n < 3 {
+		t.Errorf("openFDs() = %d, %v; want at least stdin, stdout & stderr", n, err)
+	}
+}
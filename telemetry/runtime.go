@@ -0,0 +1,258 @@
+package telemetry
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The runtime/metrics that the Go runtime metrics are read from.
+const (
+	rmGoroutines   = "/sched/goroutines:goroutines"
+	rmGomaxprocs   = "/sched/gomaxprocs:threads"
+	rmSchedLatency = "/sched/latencies:seconds"
+	rmMemTotal     = "/memory/classes/total:bytes"
+	rmMemReleased  = "/memory/classes/heap/released:bytes"
+	rmMemStacks    = "/memory/classes/heap/stacks:bytes"
+	rmMemOSStacks  = "/memory/classes/os-stacks:bytes"
+	rmMemLimit     = "/gc/gomemlimit:bytes"
+	rmHeapLive     = "/gc/heap/live:bytes"
+	rmHeapGoal     = "/gc/heap/goal:bytes"
+	rmHeapAllocs   = "/gc/heap/allocs:bytes"
+	rmHeapObjects  = "/gc/heap/allocs:objects"
+	rmGCCycles     = "/gc/cycles/total:gc-cycles"
+	rmGCPauses     = "/gc/pauses:seconds"
+	rmGOGC         = "/gc/gogc:percent"
+)
+
+var (
+	goMemoryTypeKey = attribute.Key("go.memory.type")
+	quantileKey     = attribute.Key("quantile")
+	// quantiles are the quantiles that are reported for runtime/metrics histograms.
+	quantiles = []float64{0.5, 0.9, 0.99, 1}
+)
+
+// registerRuntimeMetrics registers the Go runtime metrics, read from runtime/metrics, with m.
+// They follow the `go.*` metrics of the OTel semantic conventions; see https://opentelemetry.io/docs/specs/semconv/runtime/go-metrics/
+//
+// The OTel metrics API has no asynchronous histograms, so the scheduler latency(`go.schedule.duration`) &
+// GC pauses(`go.gc.pause.duration`) are reported as gauges of their quantiles over the last window, tagged with `quantile`.
+func registerRuntimeMetrics(m metric.Meter, window time.Duration) error {
+	r := &runtimeReader{
+		window: window,
+		sched:  &windowedHistogram{},
+		pauses: &windowedHistogram{},
+	}
+	for _, name := range []string{
+		rmGoroutines, rmGomaxprocs, rmSchedLatency, rmMemTotal, rmMemReleased, rmMemStacks, rmMemOSStacks, rmMemLimit,
+		rmHeapLive, rmHeapGoal, rmHeapAllocs, rmHeapObjects, rmGCCycles, rmGCPauses, rmGOGC,
+	} {
+		r.samples = append(r.samples, metrics.Sample{Name: name})
+	}
+
+	goroutines, err := m.Int64ObservableUpDownCounter("go.goroutine.count",
+		metric.WithDescription("count of live goroutines."), metric.WithUnit("{goroutine}"))
+	if err != nil {
+		return err
+	}
+	processors, err := m.Int64ObservableUpDownCounter("go.processor.limit",
+		metric.WithDescription("the number of OS threads that can execute user-level Go code simultaneously; GOMAXPROCS."), metric.WithUnit("{thread}"))
+	if err != nil {
+		return err
+	}
+	schedule, err := m.Float64ObservableGauge("go.schedule.duration",
+		metric.WithDescription("the time goroutines have spent in the scheduler in a runnable state before actually running."), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	memUsed, err := m.Int64ObservableUpDownCounter("go.memory.used",
+		metric.WithDescription("memory used by the Go runtime."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	memLimit, err := m.Int64ObservableUpDownCounter("go.memory.limit",
+		metric.WithDescription("Go runtime memory limit configured by the user, if a limit exists; GOMEMLIMIT."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	heapLive, err := m.Int64ObservableUpDownCounter("go.memory.heap.live",
+		metric.WithDescription("heap memory occupied by live objects that were marked by the previous GC."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	gcGoal, err := m.Int64ObservableUpDownCounter("go.memory.gc.goal",
+		metric.WithDescription("heap size target for the end of the GC cycle."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	allocated, err := m.Int64ObservableCounter("go.memory.allocated",
+		metric.WithDescription("memory allocated to the heap by the application."), metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	allocations, err := m.Int64ObservableCounter("go.memory.allocations",
+		metric.WithDescription("count of allocations to the heap by the application."), metric.WithUnit("{allocation}"))
+	if err != nil {
+		return err
+	}
+	gcCycles, err := m.Int64ObservableCounter("go.gc.count",
+		metric.WithDescription("count of completed GC cycles."), metric.WithUnit("{gc_cycle}"))
+	if err != nil {
+		return err
+	}
+	gcPauses, err := m.Float64ObservableGauge("go.gc.pause.duration",
+		metric.WithDescription("the time that goroutines were stopped for GC; stop-the-world pauses."), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	gogc, err := m.Int64ObservableUpDownCounter("go.config.gogc",
+		metric.WithDescription("heap size target percentage configured by the user; GOGC."), metric.WithUnit("%"))
+	if err != nil {
+		return err
+	}
+
+	_, err = m.RegisterCallback(
+		func(_ context.Context, o metric.Observer) error {
+			s := r.read()
+
+			o.ObserveInt64(goroutines, s.int64(rmGoroutines))
+			o.ObserveInt64(processors, s.int64(rmGomaxprocs))
+			stacks := s.int64(rmMemStacks) + s.int64(rmMemOSStacks)
+			o.ObserveInt64(memUsed, stacks, metric.WithAttributes(goMemoryTypeKey.String("stack")))
+			o.ObserveInt64(memUsed, s.int64(rmMemTotal)-s.int64(rmMemReleased)-stacks, metric.WithAttributes(goMemoryTypeKey.String("other")))
+			if limit := s.int64(rmMemLimit); limit != math.MaxInt64 {
+				// math.MaxInt64 means that there is no limit.
+				o.ObserveInt64(memLimit, limit)
+			}
+			o.ObserveInt64(heapLive, s.int64(rmHeapLive))
+			o.ObserveInt64(gcGoal, s.int64(rmHeapGoal))
+			o.ObserveInt64(allocated, s.int64(rmHeapAllocs))
+			o.ObserveInt64(allocations, s.int64(rmHeapObjects))
+			o.ObserveInt64(gcCycles, s.int64(rmGCCycles))
+			o.ObserveInt64(gogc, s.int64(rmGOGC))
+
+			for i, q := range quantiles {
+				opt := metric.WithAttributes(quantileKey.Float64(q))
+				if s.sched != nil {
+					o.ObserveFloat64(schedule, s.sched[i], opt)
+				}
+				if s.pauses != nil {
+					o.ObserveFloat64(gcPauses, s.pauses[i], opt)
+				}
+			}
+			return nil
+		},
+		goroutines, processors, schedule, memUsed, memLimit, heapLive, gcGoal, allocated, allocations, gcCycles, gcPauses, gogc,
+	)
+	return err
+}
+
+// runtimeReader reads runtime/metrics. It is called by the callbacks of all the metric readers, so it is guarded by mu.
+type runtimeReader struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	samples []metrics.Sample
+	sched   *windowedHistogram
+	pauses  *windowedHistogram
+}
+
+// runtimeSnapshot is the value of each runtime metric, by name, and the quantiles of the histograms.
+type runtimeSnapshot struct {
+	values map[string]metrics.Value
+	sched  []float64
+	pauses []float64
+}
+
+func (r *runtimeReader) read() runtimeSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics.Read(r.samples)
+	s := runtimeSnapshot{values: make(map[string]metrics.Value, len(r.samples))}
+	now := time.Now()
+	for _, sample := range r.samples {
+		s.values[sample.Name] = sample.Value
+		if sample.Value.Kind() != metrics.KindFloat64Histogram {
+			continue
+		}
+		switch sample.Name {
+		case rmSchedLatency:
+			s.sched = r.sched.quantiles(sample.Value.Float64Histogram(), now, r.window)
+		case rmGCPauses:
+			s.pauses = r.pauses.quantiles(sample.Value.Float64Histogram(), now, r.window)
+		}
+	}
+	return s
+}
+
+// int64 returns the value of the runtime metric name. It is 0 if the metric is not supported by this Go version.
+func (s runtimeSnapshot) int64(name string) int64 {
+	v, ok := s.values[name]
+	if !ok || v.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	u := v.Uint64()
+	if u > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(u)
+}
+
+// windowedHistogram computes the quantiles of a cumulative runtime/metrics histogram, over a window of time.
+// Each window is the difference between the histogram at its end & at its start.
+// Callers that read it within a window get the quantiles of the previous window; so the readers of many metric readers agree.
+type windowedHistogram struct {
+	prev      []uint64
+	prevAt    time.Time
+	quantiled []float64
+}
+
+func (w *windowedHistogram) quantiles(h *metrics.Float64Histogram, now time.Time, window time.Duration) []float64 {
+	if w.prev != nil && now.Sub(w.prevAt) < window {
+		return w.quantiled
+	}
+
+	delta := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, c := range h.Counts {
+		delta[i] = c
+		if i < len(w.prev) {
+			delta[i] -= w.prev[i]
+		}
+		total += delta[i]
+	}
+	w.prev, w.prevAt = append(w.prev[:0], h.Counts...), now
+
+	if total == 0 {
+		w.quantiled = make([]float64, len(quantiles))
+		return w.quantiled
+	}
+	w.quantiled = make([]float64, 0, len(quantiles))
+	for _, q := range quantiles {
+		w.quantiled = append(w.quantiled, bucketQuantile(q, delta, total, h.Buckets))
+	}
+	return w.quantiled
+}
+
+// bucketQuantile returns the upper bound of the bucket that holds the q quantile.
+// The bound of the last bucket may be +Inf, in which case its lower bound is used.
+func bucketQuantile(q float64, counts []uint64, total uint64, buckets []float64) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= rank && c > 0 {
+			if upper := buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper
+			}
+			return buckets[i]
+		}
+	}
+	return buckets[len(buckets)-1]
+}
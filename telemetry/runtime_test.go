@@ -0,0 +1,63 @@
+package telemetry
+
+import (
+	"math"
+	"runtime/metrics"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4, math.Inf(1)}
+	tests := []struct {
+		name   string
+		q      float64
+		counts []uint64
+		want   float64
+	}{
+		{"median", 0.5, []uint64{1, 1, 1, 1}, 2},
+		{"p90", 0.9, []uint64{1, 1, 1, 1}, 4},
+		{"max in the last bucket", 1, []uint64{1, 1, 1, 1}, 4},
+		{"max", 1, []uint64{5, 5, 0, 0}, 2},
+		{"all in the first bucket", 0.99, []uint64{10, 0, 0, 0}, 1},
+		{"empty buckets are skipped", 0.5, []uint64{0, 2, 0, 2}, 2},
+		{"p99 of many", 0.99, []uint64{98, 1, 1, 0}, 2},
+		{"p99 at a boundary", 0.99, []uint64{99, 1, 0, 0}, 1},
+	}
+	for _, tt := range tests {
+		var total uint64
+		for _, c := range tt.counts {
+			total += c
+		}
+		if got := bucketQuantile(tt.q, tt.counts, total, buckets); got != tt.want {
+			t.Errorf("%s: bucketQuantile(%v, %v) = %v, want %v", tt.name, tt.q, tt.counts, got, tt.want)
+		}
+	}
+}
+
+func TestWindowedHistogram(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4, math.Inf(1)}
+	start := time.Now()
+	w := &windowedHistogram{}
+
+	tests := []struct {
+		name   string
+		at     time.Duration
+		counts []uint64 // cumulative, as runtime/metrics reports them
+		want   []float64
+	}{
+		{"first window", 0, []uint64{10, 0, 0, 1}, []float64{1, 1, 4, 4}},
+		// Within the window, the quantiles of the previous one are returned.
+		{"within the window", 5 * time.Second, []uint64{10, 50, 0, 1}, []float64{1, 1, 4, 4}},
+		// Only the observations since the previous window count.
+		{"next window", 10 * time.Second, []uint64{10, 60, 10, 1}, []float64{2, 4, 4, 4}},
+		{"idle window", 20 * time.Second, []uint64{10, 60, 10, 1}, []float64{0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		h := &metrics.Float64Histogram{Counts: tt.counts, Buckets: buckets}
+		if got := w.quantiles(h, start.Add(tt.at), 10*time.Second); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: quantiles() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
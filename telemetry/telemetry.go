@@ -0,0 +1,232 @@
+// Package telemetry sets up tracing, metrics, logs & propagators in one go.
+//
+// usage:
+//
+//	shutdown, err := telemetry.Setup(ctx, telemetry.Config{ServiceName: "my-svc"})
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer shutdown(ctx)
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// instrumentationName is the name of the meter of the metrics that this package records.
+const instrumentationName = "github.com/komuw/otero/telemetry"
+
+// Config is the configuration of Setup.
+type Config struct {
+	// ServiceName is the `service.name` of traces, metrics & logs.
+	ServiceName string
+	// ServiceVersion is the `service.version` of traces, metrics & logs.
+	ServiceVersion string
+	// Environment is the `deployment.environment` of traces, metrics & logs.
+	Environment string
+	// Attributes are extra labels/tags that are common to all traces, metrics & logs.
+	Attributes []attribute.KeyValue
+
+	// Endpoint is the address of the otel collector that traces & metrics are exported to.
+	Endpoint string
+	// TLS is the TLS configuration of the exporters. If nil, DefaultTLSConfig is used.
+	TLS *TLSConfig
+
+	// Sampler decides which traces are sampled.
+	// If nil, 30% of traces are sampled; see DefaultSampler
+	Sampler trace.Sampler
+	// MetricsInterval is how often metrics are exported.
+	MetricsInterval time.Duration
+	// Prometheus also serves the metrics for scraping by prometheus, via MetricsHandler; in addition to exporting them to Endpoint.
+	// Exemplars are only served if the experimental exemplars of the OTel SDK are turned on, with the OTEL_GO_X_EXEMPLAR=true environment variable.
+	Prometheus bool
+
+	// Log is the configuration of the log package. If nil, the current one is left as is.
+	// Its ServiceName is set to ServiceName.
+	Log *log.Config
+
+	// ShutdownTimeout is how long the shutdown function waits for traces & metrics to be flushed.
+	ShutdownTimeout time.Duration
+}
+
+// DefaultConfig returns the configuration that is used for the fields of Config that are not set.
+func DefaultConfig() Config {
+	return Config{
+		ServiceVersion:  "0.0.1",
+		Environment:     "staging",
+		Endpoint:        "otel_collector:4317",
+		MetricsInterval: 2 * time.Second,
+		ShutdownTimeout: 5 * time.Second,
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.ServiceVersion == "" {
+		c.ServiceVersion = d.ServiceVersion
+	}
+	if c.Environment == "" {
+		c.Environment = d.Environment
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = d.Endpoint
+	}
+	t := DefaultTLSConfig()
+	if c.TLS != nil {
+		// A copy, so that the TLSConfig of the caller is not modified.
+		t = *c.TLS
+	}
+	if t.CertReloadInterval <= 0 {
+		t.CertReloadInterval = DefaultTLSConfig().CertReloadInterval
+	}
+	if t.Insecure {
+		t.MutualTLS = false
+	}
+	c.TLS = &t
+	if c.Sampler == nil {
+		c.Sampler = DefaultSampler()
+	}
+	if c.MetricsInterval <= 0 {
+		c.MetricsInterval = d.MetricsInterval
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = d.ShutdownTimeout
+	}
+	return c
+}
+
+// Setup initialises tracing, metrics, logs & propagators, and sets them as the otel globals.
+//
+// It returns a shutdown function that flushes & stops all of them. The shutdown function can be called many times,
+// only the first call does the work. It waits for at most Config.ShutdownTimeout, and returns all the errors that occurred.
+func Setup(ctx context.Context, c Config) (shutdown func(context.Context) error, err error) {
+	if c.ServiceName == "" {
+		return nil, errors.New("telemetry: ServiceName is required")
+	}
+	c = c.withDefaults()
+	if err := c.TLS.validate(); err != nil {
+		return nil, err
+	}
+
+	// Logs come first, so that errors in setting up the rest are logged.
+	if c.Log != nil {
+		lc := *c.Log
+		lc.ServiceName = c.ServiceName
+		if err := log.SetConfig(lc); err != nil {
+			return nil, err
+		}
+	}
+	// Internal errors & logs of the OTel SDK(eg, exporter failures) go to our loggers & metrics,
+	// instead of stderr where they are easily missed.
+	otel.SetErrorHandler(log.ErrorHandler())
+	otel.SetLogger(log.NewLogr())
+
+	// res is used by the tracer & meter providers, and its service attributes are added to every log.
+	res := newResource(c)
+	log.SetResource(res)
+
+	/*
+		Alternative ways of providing a propagator:
+		  (a)
+			propagator := ot.OT{}
+			otel.SetTextMapPropagator(propagator)
+
+		  (b)
+		    import "go.opentelemetry.io/contrib/propagators/b3"
+			otel.SetTextMapPropagator(
+			  b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader))
+		    )
+	*/
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	)
+
+	var certs *certSource
+	watchCtx, stopWatching := context.WithCancel(context.WithoutCancel(ctx))
+	if !c.TLS.Insecure {
+		certs, err = newCertSource(*c.TLS, c.TLS.serverName(c.Endpoint), c.TLS.serverName(c.Endpoint))
+		if err != nil {
+			stopWatching()
+			return nil, err
+		}
+		certs.warnExpiry(ctx, expiryWarning(*c.TLS))
+		go certs.watch(watchCtx, c.TLS.CertReloadInterval)
+	}
+
+	tp, err := setupTracing(ctx, c, res, certs)
+	if err != nil {
+		stopWatching()
+		return nil, err
+	}
+
+	mp, err := setupMetrics(ctx, c, res, certs)
+	if err != nil {
+		stopWatching()
+		return nil, errors.Join(err, tp.Shutdown(ctx))
+	}
+	// Every service gets the baseline health metrics of the Go runtime & of its process.
+	meter := mp.Meter(instrumentationName)
+	if err := registerRuntimeMetrics(meter, c.MetricsInterval); err != nil {
+		stopWatching()
+		return nil, errors.Join(err, tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}
+	if err := registerProcessMetrics(ctx, meter); err != nil {
+		stopWatching()
+		return nil, errors.Join(err, tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}
+	if certs != nil {
+		if err := certs.observeExpiry(meter); err != nil {
+			stopWatching()
+			return nil, errors.Join(err, tp.Shutdown(ctx), mp.Shutdown(ctx))
+		}
+	}
+
+	var (
+		once        sync.Once
+		shutdownErr error
+	)
+	shutdown = func(ctx context.Context) error {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(ctx, c.ShutdownTimeout)
+			defer cancel()
+
+			// Both are shut down concurrently, so that one that is slow does not use up the timeout of the other.
+			var wg sync.WaitGroup
+			var tErr, mErr error
+			wg.Add(2)
+			go func() { defer wg.Done(); tErr = tp.Shutdown(ctx) }()
+			go func() { defer wg.Done(); mErr = mp.Shutdown(ctx) }()
+			wg.Wait()
+
+			shutdownErr = errors.Join(tErr, mErr)
+			stopWatching()
+		})
+		return shutdownErr
+	}
+
+	return shutdown, nil
+}
+
+// newResource returns the labels/tags that are common to all traces, metrics & logs.
+func newResource(c Config) *resource.Resource {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(c.ServiceName),
+		semconv.ServiceVersionKey.String(c.ServiceVersion),
+		semconv.DeploymentEnvironmentKey.String(c.Environment),
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, append(attrs, c.Attributes...)...)
+}
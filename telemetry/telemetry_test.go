@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// insecureConfig returns a Config that exports, in plaintext, to an endpoint that nothing listens on.
+// Its logs go to a file in a temporary directory.
+func insecureConfig(t *testing.T) Config {
+	t.Helper()
+
+	lc := log.DefaultConfig()
+	lc.Output = filepath.Join(t.TempDir(), "out.log")
+	return Config{
+		ServiceName:     "svc",
+		Endpoint:        "127.0.0.1:1",
+		TLS:             &TLSConfig{Insecure: true},
+		Log:             &lc,
+		ShutdownTimeout: 200 * time.Millisecond,
+	}
+}
+
+// setup calls Setup, and shuts down what it set up at the end of the test.
+func setup(t *testing.T, c Config) func(context.Context) error {
+	t.Helper()
+
+	prevLog := log.GetConfig()
+	shutdown, err := Setup(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = shutdown(context.Background())
+		_ = log.SetConfig(prevLog)
+	})
+	return shutdown
+}
+
+func TestSetup(t *testing.T) {
+	c := insecureConfig(t)
+	c.Attributes = []attribute.KeyValue{attribute.String("team", "x")}
+	c.Sampler = sdktrace.AlwaysSample()
+	setup(t, c)
+
+	tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	if !ok {
+		t.Fatalf("global TracerProvider is a %T", otel.GetTracerProvider())
+	}
+	if _, ok := otel.GetMeterProvider().(*sdkmetric.MeterProvider); !ok {
+		t.Errorf("global MeterProvider is a %T", otel.GetMeterProvider())
+	}
+	fields := otel.GetTextMapPropagator().Fields()
+	slices.Sort(fields)
+	if !slices.Equal(fields, []string{"baggage", "traceparent", "tracestate"}) {
+		t.Errorf("propagator fields = %v", fields)
+	}
+
+	got := log.GetConfig()
+	if got.ServiceName != "svc" || got.Output != c.Log.Output {
+		t.Errorf("log config = %+v, want the service name & output to be set", got)
+	}
+
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	span.End()
+	s, ok := span.(sdktrace.ReadOnlySpan)
+	if !ok {
+		t.Fatalf("span is a %T", span)
+	}
+	res := s.Resource().Set()
+	for k, want := range map[attribute.Key]string{
+		"service.name":           "svc",
+		"service.version":        "0.0.1",
+		"deployment.environment": "staging",
+		"team":                   "x",
+	} {
+		if v, _ := res.Value(k); v.AsString() != want {
+			t.Errorf("resource %s = %q, want %q", k, v.AsString(), want)
+		}
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"service name", func(c *Config) { c.ServiceName = "" }},
+		{"tls", func(c *Config) { c.TLS = &TLSConfig{MinVersion: "1.0"} }},
+		{"log", func(c *Config) { c.Log = &log.Config{Backend: "log4j"} }},
+	}
+	for _, tt := range tests {
+		c := insecureConfig(t)
+		tt.modify(&c)
+		shutdown, err := Setup(context.Background(), c)
+		if err == nil {
+			_ = shutdown(context.Background())
+			t.Errorf("%s: Setup() expected an error", tt.name)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	c := insecureConfig(t)
+	shutdown := setup(t, c)
+
+	// Metrics are flushed on shutdown; the export fails since the collector can not be reached.
+	start := time.Now()
+	first := shutdown(context.Background())
+	if d := time.Since(start); d > c.ShutdownTimeout+time.Second {
+		t.Errorf("shutdown took %v, longer than the timeout of %v", d, c.ShutdownTimeout)
+	}
+
+	// Only the first call does the work; the rest return its result.
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if err := shutdown(context.Background()); err != first {
+			t.Errorf("shutdown() call %d = %v, want %v", i+2, err, first)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("repeated shutdowns took %v", d)
+	}
+}
+
+func TestConfigWithDefaults(t *testing.T) {
+	got := Config{ServiceName: "svc"}.withDefaults()
+	d := DefaultConfig()
+	if got.ServiceVersion != d.ServiceVersion || got.Environment != d.Environment || got.Endpoint != d.Endpoint ||
+		got.MetricsInterval != d.MetricsInterval || got.ShutdownTimeout != d.ShutdownTimeout {
+		t.Errorf("withDefaults() = %+v", got)
+	}
+	if got.TLS == nil || got.Sampler == nil {
+		t.Errorf("withDefaults() did not set TLS or Sampler: %+v", got)
+	}
+
+	c := Config{ServiceName: "svc", Endpoint: "collector:4317", ShutdownTimeout: time.Minute}.withDefaults()
+	if c.Endpoint != "collector:4317" || c.ShutdownTimeout != time.Minute {
+		t.Errorf("withDefaults() overrode the fields that were set: %+v", c)
+	}
+}
@@ -0,0 +1,318 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/komuw/otero/log"
+)
+
+// certSource holds the TLS credentials that are loaded from files.
+// It watches the files & reloads the credentials when they change, so that certificates can be rotated without a restart.
+// New credentials are validated before they are swapped in; if they are invalid, the previous ones are kept.
+type certSource struct {
+	conf TLSConfig
+	// host is the host name that the certificate needs a SAN for, if not empty; eg, the collector's.
+	host string
+	// serverName is the name that the certificates of servers are verified against.
+	// If empty, the name that the client connected to is used; see verifyServer.
+	serverName string
+	// certKind is the kind of cert in the `tls.certificate.expiry` gauge; see observeExpiry.
+	certKind string
+
+	mu sync.RWMutex
+	// cert is nil, unless conf.MutualTLS is set.
+	cert  *tls.Certificate
+	roots *x509.CertPool
+	// caCerts are the certificates in conf.CAFile
+	caCerts []*x509.Certificate
+	// stats is the state of the files when they were last loaded; see changed.
+	stats [3]fileStat
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// newCertSource loads the credentials in the files of c.
+// It fails if they are invalid; eg, the key does not match the certificate or the certificate has no SAN for host.
+func newCertSource(c TLSConfig, host, serverName string) (*certSource, error) {
+	s := &certSource{conf: c, host: host, serverName: serverName, certKind: certKindClient}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// tlsCreds are the credentials loaded from the files.
+type tlsCreds struct {
+	cert    *tls.Certificate
+	roots   *x509.CertPool
+	caCerts []*x509.Certificate
+}
+
+// load reads & validates the credentials in the files.
+func (s *certSource) load() (tlsCreds, error) {
+	var creds tlsCreds
+
+	creds.roots = x509.NewCertPool()
+	if s.conf.SystemRoots {
+		sys, err := x509.SystemCertPool()
+		if err != nil {
+			return creds, fmt.Errorf("telemetry: failed to load the system's root CAs: %w", err)
+		}
+		creds.roots = sys
+	}
+	if s.conf.CAFile != "" {
+		caCerts, err := parseCertificates(s.conf.CAFile)
+		if err != nil {
+			return creds, fmt.Errorf("telemetry: TLS.CAFile: %w", err)
+		}
+		for _, c := range caCerts {
+			creds.roots.AddCert(c)
+		}
+		creds.caCerts = caCerts
+	}
+
+	if !s.conf.MutualTLS {
+		return creds, nil
+	}
+
+	// LoadX509KeyPair also checks that the private key matches the certificate.
+	cert, err := tls.LoadX509KeyPair(s.conf.CertFile, s.conf.KeyFile)
+	if err != nil {
+		return creds, fmt.Errorf("telemetry: TLS.CertFile & TLS.KeyFile: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return creds, fmt.Errorf("telemetry: TLS.CertFile: %w", err)
+	}
+	cert.Leaf = leaf
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return creds, fmt.Errorf("telemetry: certificate %s is not valid at this time; it is valid from %s to %s", s.conf.CertFile, leaf.NotBefore, leaf.NotAfter)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: creds.roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return creds, fmt.Errorf("telemetry: certificate %s is not signed by a trusted root CA: %w", s.conf.CertFile, err)
+	}
+	if s.host != "" {
+		if err := leaf.VerifyHostname(s.host); err != nil {
+			return creds, fmt.Errorf("telemetry: certificate %s has no SAN for %q(its SANs are DNS:%v IP:%v): %w",
+				s.conf.CertFile, s.host, leaf.DNSNames, leaf.IPAddresses, err)
+		}
+	}
+
+	creds.cert = &cert
+	return creds, nil
+}
+
+// parseCertificates returns the certificates in the PEM file f.
+func parseCertificates(f string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", f)
+	}
+	return certs, nil
+}
+
+// reload swaps in the credentials in the files, if they are valid.
+func (s *certSource) reload() error {
+	stats := s.stat()
+	creds, err := s.load()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The stats are updated even on failure, so that a half written file is not reloaded again & again.
+	// It will be reloaded once it is written in full, since that changes its stats.
+	s.stats = stats
+	if err != nil {
+		return err
+	}
+	s.cert, s.roots, s.caCerts = creds.cert, creds.roots, creds.caCerts
+	return nil
+}
+
+func (s *certSource) stat() [3]fileStat {
+	var stats [3]fileStat
+	for i, f := range []string{s.conf.CAFile, s.conf.CertFile, s.conf.KeyFile} {
+		if f == "" {
+			continue
+		}
+		if fi, err := os.Stat(f); err == nil {
+			stats[i] = fileStat{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stats
+}
+
+// changed reports whether any of the files has changed since it was last loaded.
+func (s *certSource) changed() bool {
+	stats := s.stat()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return stats != s.stats
+}
+
+// watch reloads the credentials whenever the files change, checking every interval, until ctx is done.
+func (s *certSource) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if !s.changed() {
+			continue
+		}
+
+		l := log.New(ctx)
+		if err := s.reload(); err != nil {
+			l.Error("failed to reload tls credentials; the previous ones are still in use",
+				"error", err, "cert_file", s.conf.CertFile, "key_file", s.conf.KeyFile, "ca_file", s.conf.CAFile)
+			continue
+		}
+		if cert := s.certificate(); cert != nil {
+			l.Info("tls credentials rotated",
+				"cert_file", s.conf.CertFile,
+				"subject", cert.Leaf.Subject.String(),
+				"serial", cert.Leaf.SerialNumber.String(),
+				"not_after", cert.Leaf.NotAfter,
+			)
+		} else {
+			l.Info("tls root CAs rotated", "ca_file", s.conf.CAFile)
+		}
+	}
+}
+
+func (s *certSource) certificate() *tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cert
+}
+
+func (s *certSource) rootCAs() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.roots
+}
+
+// clientConfig returns a configuration, for use by clients, that enables the use of TLS;
+// and of mutual TLS, if TLSConfig.MutualTLS is set. It always uses the current credentials.
+// TLSConfig has been validated by then, so it does not fail.
+func (s *certSource) clientConfig() *tls.Config {
+	minVersion, _ := parseTLSVersion(s.conf.MinVersion)
+	cipherSuites, _ := parseCipherSuites(s.conf.CipherSuites)
+
+	c := &tls.Config{
+		ServerName:   s.conf.ServerName,
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		// tls.Config.RootCAs cannot be changed once the config is in use, so the server is verified
+		// against the current root CAs by verifyServer instead.
+		InsecureSkipVerify: true,
+		VerifyConnection:   s.verifyServer,
+	}
+	if s.conf.MutualTLS {
+		c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.certificate(), nil
+		}
+	}
+	return c
+}
+
+// verifyServer does the verification that the tls package would have done, were InsecureSkipVerify false.
+// The certificate is verified against serverName. cs.ServerName is only used if that is empty,
+// since it is empty when the client connects to an IP address; and an empty name skips the hostname check.
+func (s *certSource) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("telemetry: server did not present a certificate")
+	}
+	name := s.serverName
+	if name == "" {
+		name = cs.ServerName
+	}
+	if name == "" {
+		return errors.New("telemetry: there is no server name to verify the certificate of the server against; set TLS.ServerName")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         s.rootCAs(),
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// serverConfig returns a configuration, for use by servers, that requires clients to present a certificate signed by the root CA.
+// It always uses the current credentials. It fails unless TLSConfig.MutualTLS is set, since the server then has no certificate.
+func (s *certSource) serverConfig() (*tls.Config, error) {
+	if !s.conf.MutualTLS || s.certificate() == nil {
+		return nil, errors.New("telemetry: TLS.MutualTLS is required for servers; there is no certificate to serve")
+	}
+	minVersion, _ := parseTLSVersion(s.conf.MinVersion)
+	cipherSuites, _ := parseCipherSuites(s.conf.CipherSuites)
+	// The config of GetConfigForClient is used as is, so it would otherwise not negotiate http2.
+	nextProtos := []string{"h2", "http/1.1"}
+
+	return &tls.Config{
+		// GetCertificate is not used, since GetConfigForClient takes precedence.
+		// It is set so that http.Server.ListenAndServeTLS does not look for certificate files.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.certificate(), nil
+		},
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			return &tls.Config{
+				Certificates: []tls.Certificate{*s.cert},
+				ClientCAs:    s.roots,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				MinVersion:   minVersion,
+				CipherSuites: cipherSuites,
+				NextProtos:   nextProtos,
+			}, nil
+		},
+	}, nil
+}
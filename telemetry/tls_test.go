@@ -0,0 +1,237 @@
+package telemetry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a root CA that issues certificates into a temporary directory.
+type testPKI struct {
+	t      *testing.T
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caFile string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	p := &testPKI{t: t, dir: t.TempDir()}
+	p.ca, p.caKey, p.caFile = p.issue("rootCA", nil, nil, time.Now().Add(24*time.Hour), true)
+	return p
+}
+
+// cert issues a certificate, valid until notAfter, with the SANs; IP addresses become IP SANs.
+// It returns the paths of the certificate & its key.
+func (p *testPKI) cert(name string, notAfter time.Time, sans ...string) (certFile, keyFile string) {
+	p.t.Helper()
+
+	_, _, certFile = p.issue(name, p.ca, p.caKey, notAfter, false, sans...)
+	return certFile, filepath.Join(p.dir, name+".key")
+}
+
+func (p *testPKI) issue(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, notAfter time.Time, isCA bool, sans ...string) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	p.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"otero"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, s := range sans {
+		if ip := net.ParseIP(s); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, s)
+		}
+	}
+	if isCA {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		p.t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		p.t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		p.t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	certFile := filepath.Join(p.dir, name+".crt")
+	p.write(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	p.write(filepath.Join(p.dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return cert, key, certFile
+}
+
+func (p *testPKI) write(name string, data []byte) {
+	p.t.Helper()
+
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		p.t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+// tlsConfig returns a TLSConfig that uses the root CA, and the certificate name for mutual TLS.
+func (p *testPKI) tlsConfig(name string, sans ...string) TLSConfig {
+	p.t.Helper()
+
+	c := DefaultTLSConfig()
+	c.CAFile = p.caFile
+	c.CertFile, c.KeyFile = p.cert(name, time.Now().Add(12*time.Hour), sans...)
+	return c
+}
+
+func TestVerifyServer(t *testing.T) {
+	p := newTestPKI(t)
+	other := newTestPKI(t)
+	leaf := func(pki *testPKI, sans ...string) *x509.Certificate {
+		certFile, _ := pki.cert("server", time.Now().Add(time.Hour), sans...)
+		certs, err := parseCertificates(certFile)
+		if err != nil {
+			t.Fatalf("parseCertificates() error = %v", err)
+		}
+		return certs[0]
+	}
+
+	tests := []struct {
+		name       string
+		serverName string
+		connected  string
+		certs      []*x509.Certificate
+		wantErr    string
+	}{
+		{"name", "otel_collector", "", []*x509.Certificate{leaf(p, "otel_collector")}, ""},
+		{"ip", "127.0.0.1", "", []*x509.Certificate{leaf(p, "127.0.0.1")}, ""},
+		// The tls package does not set the server name of connections to IP addresses; the configured name is used.
+		{"ip without a san", "127.0.0.1", "", []*x509.Certificate{leaf(p, "otel_collector")}, "127.0.0.1"},
+		{"wrong san", "otel_collector", "otel_collector", []*x509.Certificate{leaf(p, "jaeger")}, "otel_collector"},
+		{"configured name takes precedence", "otel_collector", "jaeger", []*x509.Certificate{leaf(p, "jaeger")}, "otel_collector"},
+		{"connected name", "", "jaeger", []*x509.Certificate{leaf(p, "jaeger")}, ""},
+		{"no name", "", "", []*x509.Certificate{leaf(p, "otel_collector")}, "no server name"},
+		{"untrusted ca", "otel_collector", "", []*x509.Certificate{leaf(other, "otel_collector")}, "unknown authority"},
+		{"no certificate", "otel_collector", "", nil, "did not present a certificate"},
+	}
+	for _, tt := range tests {
+		s, err := newCertSource(TLSConfig{CAFile: p.caFile}, "", tt.serverName)
+		if err != nil {
+			t.Fatalf("newCertSource() error = %v", err)
+		}
+		err = s.verifyServer(tls.ConnectionState{ServerName: tt.connected, PeerCertificates: tt.certs})
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: verifyServer() error = %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: verifyServer() error = %v, want one that contains %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestClientConfigHandshake(t *testing.T) {
+	p := newTestPKI(t)
+	serverCert, serverKey := p.cert("collector", time.Now().Add(time.Hour), "otel_collector")
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair() error = %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name       string
+		serverName string
+		wantErr    bool
+	}{
+		// The server is dialled by IP, but its certificate only has a SAN for otel_collector.
+		{"endpoint ip", "127.0.0.1", true},
+		{"configured name", "otel_collector", false},
+		{"wrong name", "jaeger", true},
+	}
+	for _, tt := range tests {
+		c := TLSConfig{CAFile: p.caFile, ServerName: tt.serverName}
+		s, err := newCertSource(c, "", c.serverName(ln.Addr().String()))
+		if err != nil {
+			t.Fatalf("newCertSource() error = %v", err)
+		}
+		conn, err := tls.Dial("tcp", ln.Addr().String(), s.clientConfig())
+		if err == nil {
+			conn.Close()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Dial() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCertSourceLoad(t *testing.T) {
+	p := newTestPKI(t)
+	other := newTestPKI(t)
+	otherCert, _ := other.cert("client", time.Now().Add(time.Hour), "otel_collector")
+	expired, expiredKey := p.cert("expired", time.Now().Add(-time.Minute), "otel_collector")
+
+	tests := []struct {
+		name    string
+		modify  func(*TLSConfig)
+		host    string
+		wantErr string
+	}{
+		{"valid", func(c *TLSConfig) {}, "otel_collector", ""},
+		{"no host", func(c *TLSConfig) {}, "", ""},
+		{"no san for host", func(c *TLSConfig) {}, "jaeger", "has no SAN"},
+		{"key mismatch", func(c *TLSConfig) { c.KeyFile = expiredKey }, "", "private key does not match"},
+		{"expired", func(c *TLSConfig) { c.CertFile, c.KeyFile = expired, expiredKey }, "", "not valid at this time"},
+		{"untrusted", func(c *TLSConfig) { c.CertFile, c.KeyFile = otherCert, filepath.Join(other.dir, "client.key") }, "", "not signed by a trusted root CA"},
+		{"no ca", func(c *TLSConfig) { c.CAFile = filepath.Join(p.dir, "missing.crt") }, "", "TLS.CAFile"},
+	}
+	for _, tt := range tests {
+		c := p.tlsConfig("client", "otel_collector")
+		tt.modify(&c)
+		_, err := newCertSource(c, tt.host, "")
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: newCertSource() error = %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: newCertSource() error = %v, want one that contains %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLSConfig is the TLS configuration of the exporters that send telemetry to the otel collector.
+// It is applied to both the trace & metric exporters.
+// There is no log exporter, so it does not apply to logs; they are written out by the log package, and shipping them is out of scope.
+type TLSConfig struct {
+	// Insecure sends telemetry in plaintext, without TLS. Only use it for local development.
+	// It turns off MutualTLS, since plaintext connections have no client certificates.
+	Insecure bool
+	// MutualTLS presents the client certificate in CertFile & KeyFile to the collector.
+	MutualTLS bool
+
+	// CAFile is the root CA that the certificate of the collector is verified against.
+	CAFile string
+	// SystemRoots verifies the certificate of the collector against the system's root CAs, in addition to CAFile.
+	// If CAFile is empty, only the system's root CAs are used.
+	SystemRoots bool
+	// CertFile & KeyFile are the client certificate & key used for MutualTLS.
+	CertFile string
+	KeyFile  string
+	// CertReloadInterval is how often the certificate files are checked for changes.
+	// They are reloaded when they change, so certificates can be rotated without a restart.
+	CertReloadInterval time.Duration
+	// ExpiryWarningDays is how many days before the client or CA certificate expires that a warning is logged at startup.
+	// Zero disables the warning. The time left is also exported in the `tls.certificate.expiry` metric.
+	ExpiryWarningDays int
+
+	// ServerName is used for SNI & to verify the certificate of the collector.
+	// If empty, the host of Config.Endpoint is used.
+	ServerName string
+	// MinVersion is the minimum TLS version; "1.2" or "1.3"
+	MinVersion string
+	// CipherSuites are the names of the cipher suites that may be used with TLS 1.2; see tls.CipherSuites
+	// If empty, Go's defaults are used. The cipher suites of TLS 1.3 are not configurable.
+	CipherSuites []string
+}
+
+// DefaultTLSConfig returns the TLS configuration that is used if Config.TLS is nil.
+func DefaultTLSConfig() TLSConfig {
+	return TLSConfig{
+		MutualTLS:          true,
+		CAFile:             "./confs/tls/rootCA.crt",
+		CertFile:           "./confs/tls/client.crt",
+		KeyFile:            "./confs/tls/client.key",
+		CertReloadInterval: 10 * time.Second,
+		ExpiryWarningDays:  30,
+		MinVersion:         "1.2",
+	}
+}
+
+// TLSConfigFromEnv returns DefaultTLSConfig overridden by the following environment variables(if set);
+// OTERO_TELEMETRY_TLS_INSECURE, OTERO_TELEMETRY_TLS_MUTUAL, OTERO_TELEMETRY_TLS_CA_FILE, OTERO_TELEMETRY_TLS_SYSTEM_ROOTS,
+// OTERO_TELEMETRY_TLS_CERT_FILE, OTERO_TELEMETRY_TLS_KEY_FILE, OTERO_TELEMETRY_TLS_SERVER_NAME, OTERO_TELEMETRY_TLS_MIN_VERSION,
+// OTERO_TELEMETRY_TLS_CIPHER_SUITES(comma separated) & OTERO_TELEMETRY_TLS_EXPIRY_WARNING_DAYS.
+func TLSConfigFromEnv() (TLSConfig, error) {
+	c := DefaultTLSConfig()
+
+	for name, dst := range map[string]*bool{
+		"OTERO_TELEMETRY_TLS_INSECURE":     &c.Insecure,
+		"OTERO_TELEMETRY_TLS_MUTUAL":       &c.MutualTLS,
+		"OTERO_TELEMETRY_TLS_SYSTEM_ROOTS": &c.SystemRoots,
+	} {
+		if v := os.Getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return c, fmt.Errorf("telemetry: invalid %s: %w", name, err)
+			}
+			*dst = b
+		}
+	}
+	for name, dst := range map[string]*string{
+		"OTERO_TELEMETRY_TLS_CA_FILE":     &c.CAFile,
+		"OTERO_TELEMETRY_TLS_CERT_FILE":   &c.CertFile,
+		"OTERO_TELEMETRY_TLS_KEY_FILE":    &c.KeyFile,
+		"OTERO_TELEMETRY_TLS_SERVER_NAME": &c.ServerName,
+		"OTERO_TELEMETRY_TLS_MIN_VERSION": &c.MinVersion,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	if v := os.Getenv("OTERO_TELEMETRY_TLS_CIPHER_SUITES"); v != "" {
+		c.CipherSuites = strings.Split(v, ",")
+	}
+	if v := os.Getenv("OTERO_TELEMETRY_TLS_EXPIRY_WARNING_DAYS"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			return c, fmt.Errorf("telemetry: invalid OTERO_TELEMETRY_TLS_EXPIRY_WARNING_DAYS: %w", err)
+		}
+		c.ExpiryWarningDays = d
+	}
+
+	return c, nil
+}
+
+func (c TLSConfig) validate() error {
+	if c.Insecure {
+		// None of the other fields are used.
+		return nil
+	}
+
+	if c.CAFile == "" && !c.SystemRoots {
+		return errors.New("telemetry: TLS.CAFile is required, unless TLS.SystemRoots is set")
+	}
+	if c.MutualTLS && (c.CertFile == "" || c.KeyFile == "") {
+		return errors.New("telemetry: TLS.CertFile & TLS.KeyFile are required when TLS.MutualTLS is set")
+	}
+	files := map[string]string{}
+	if c.CAFile != "" {
+		files["TLS.CAFile"] = c.CAFile
+	}
+	if c.MutualTLS {
+		files["TLS.CertFile"], files["TLS.KeyFile"] = c.CertFile, c.KeyFile
+	}
+	for field, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("telemetry: %s: %w", field, err)
+		}
+	}
+
+	if c.ExpiryWarningDays < 0 {
+		return fmt.Errorf("telemetry: invalid TLS.ExpiryWarningDays %d; it cannot be negative", c.ExpiryWarningDays)
+	}
+	if _, err := parseTLSVersion(c.MinVersion); err != nil {
+		return err
+	}
+	if _, err := parseCipherSuites(c.CipherSuites); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("telemetry: invalid TLS.MinVersion %q; valid ones are 1.2 & 1.3", v)
+	}
+}
+
+// parseCipherSuites returns the ids of the named cipher suites. Insecure cipher suites are not allowed.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	valid := map[string]uint16{}
+	validNames := []string{}
+	for _, s := range tls.CipherSuites() {
+		valid[s.Name] = s.ID
+		validNames = append(validNames, s.Name)
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, n := range names {
+		id, ok := valid[strings.TrimSpace(n)]
+		if !ok {
+			return nil, fmt.Errorf("telemetry: invalid or insecure TLS cipher suite %q; valid ones are %s", n, strings.Join(validNames, ", "))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// serverName returns the name that the collector at endpoint is verified against.
+func (c TLSConfig) serverName(endpoint string) string {
+	if c.ServerName != "" {
+		return c.ServerName
+	}
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		// endpoint has no port.
+		return endpoint
+	}
+	return host
+}
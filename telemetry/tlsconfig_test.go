@@ -0,0 +1,137 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTLSConfigValidate(t *testing.T) {
+	p := newTestPKI(t)
+	missing := filepath.Join(p.dir, "missing.crt")
+
+	tests := []struct {
+		name    string
+		modify  func(*TLSConfig)
+		wantErr string
+	}{
+		{"valid", func(c *TLSConfig) {}, ""},
+		// The default has MutualTLS set; Insecure turns it off.
+		{"insecure", func(c *TLSConfig) { *c = DefaultTLSConfig(); c.Insecure = true }, ""},
+		{"insecure ignores the files", func(c *TLSConfig) { c.Insecure, c.CAFile, c.CertFile = true, missing, missing }, ""},
+		{"system roots", func(c *TLSConfig) { c.CAFile, c.SystemRoots = "", true }, ""},
+		{"no mutual tls", func(c *TLSConfig) { c.MutualTLS, c.CertFile, c.KeyFile = false, "", "" }, ""},
+		{"no ca", func(c *TLSConfig) { c.CAFile = "" }, "TLS.CAFile is required"},
+		{"no cert", func(c *TLSConfig) { c.CertFile = "" }, "TLS.CertFile & TLS.KeyFile are required"},
+		{"missing ca", func(c *TLSConfig) { c.CAFile = missing }, "TLS.CAFile"},
+		{"missing key", func(c *TLSConfig) { c.KeyFile = missing }, "TLS.KeyFile"},
+		{"expiry warning", func(c *TLSConfig) { c.ExpiryWarningDays = -1 }, "cannot be negative"},
+		{"min version", func(c *TLSConfig) { c.MinVersion = "1.1" }, "invalid TLS.MinVersion"},
+		{"cipher suite", func(c *TLSConfig) { c.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }, "insecure TLS cipher suite"},
+	}
+	for _, tt := range tests {
+		c := p.tlsConfig("client")
+		tt.modify(&c)
+		err := c.validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: validate() error = %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: validate() error = %v, want one that contains %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSetupInsecureDefault(t *testing.T) {
+	tc := DefaultTLSConfig()
+	tc.Insecure = true
+	c := insecureConfig(t)
+	c.TLS = &tc
+	setup(t, c)
+
+	if !tc.MutualTLS {
+		t.Error("Setup modified the TLSConfig of the caller")
+	}
+	if got := c.withDefaults().TLS; got.MutualTLS {
+		t.Errorf("withDefaults().TLS.MutualTLS = true, want Insecure to turn it off")
+	}
+}
+
+func TestNewCredentialsInsecure(t *testing.T) {
+	p := newTestPKI(t)
+	c := p.tlsConfig("service")
+	c.Insecure = true
+	if _, err := NewCredentials(context.Background(), c, ""); err == nil {
+		t.Error("NewCredentials() with TLS.Insecure; expected an error")
+	}
+}
+
+func TestTLSConfigFromEnv(t *testing.T) {
+	t.Setenv("OTERO_TELEMETRY_TLS_INSECURE", "true")
+	t.Setenv("OTERO_TELEMETRY_TLS_SYSTEM_ROOTS", "1")
+	t.Setenv("OTERO_TELEMETRY_TLS_CA_FILE", "/etc/ca.crt")
+	t.Setenv("OTERO_TELEMETRY_TLS_SERVER_NAME", "collector.internal")
+	t.Setenv("OTERO_TELEMETRY_TLS_MIN_VERSION", "1.3")
+	t.Setenv("OTERO_TELEMETRY_TLS_CIPHER_SUITES", "a,b")
+	t.Setenv("OTERO_TELEMETRY_TLS_EXPIRY_WARNING_DAYS", "7")
+
+	c, err := TLSConfigFromEnv()
+	if err != nil {
+		t.Fatalf("TLSConfigFromEnv() error = %v", err)
+	}
+	want := DefaultTLSConfig()
+	want.Insecure, want.SystemRoots = true, true
+	want.CAFile, want.ServerName, want.MinVersion = "/etc/ca.crt", "collector.internal", "1.3"
+	want.CipherSuites = []string{"a", "b"}
+	want.ExpiryWarningDays = 7
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("TLSConfigFromEnv() = %+v, want %+v", c, want)
+	}
+
+	for name, v := range map[string]string{"OTERO_TELEMETRY_TLS_MUTUAL": "maybe", "OTERO_TELEMETRY_TLS_EXPIRY_WARNING_DAYS": "soon"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, v)
+			if _, err := TLSConfigFromEnv(); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("TLSConfigFromEnv() error = %v, want one about %s", err, name)
+			}
+		})
+	}
+}
+
+func TestParseTLS(t *testing.T) {
+	for v, want := range map[string]uint16{"": tls.VersionTLS12, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		if got, err := parseTLSVersion(v); err != nil || got != want {
+			t.Errorf("parseTLSVersion(%q) = %d, %v; want %d", v, got, err, want)
+		}
+	}
+
+	got, err := parseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	want := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCipherSuites() = %v, %v; want %v", got, err, want)
+	}
+	if got, err := parseCipherSuites(nil); err != nil || got != nil {
+		t.Errorf("parseCipherSuites(nil) = %v, %v; want nil", got, err)
+	}
+}
+
+func TestTLSConfigServerName(t *testing.T) {
+	tests := []struct {
+		serverName, endpoint, want string
+	}{
+		{"", "otel_collector:4317", "otel_collector"},
+		{"", "127.0.0.1:4317", "127.0.0.1"},
+		{"", "[::1]:4317", "::1"},
+		{"", "otel_collector", "otel_collector"},
+		{"collector.internal", "127.0.0.1:4317", "collector.internal"},
+	}
+	for _, tt := range tests {
+		c := TLSConfig{ServerName: tt.serverName}
+		if got := c.serverName(tt.endpoint); got != tt.want {
+			t.Errorf("TLSConfig{ServerName: %q}.serverName(%q) = %q, want %q", tt.serverName, tt.endpoint, got, tt.want)
+		}
+	}
+}
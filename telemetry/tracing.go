@@ -0,0 +1,97 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/komuw/otero/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultSampler samples 30% of traces.
+//
+// There's head-based sampling and tail-based sampling.
+// Tail based sampling would enable you to say something like;
+// `Sample 5% of success but 100% of all the errors.`
+//
+// There's also filter processor that can be used in place of tail based sampling.
+//
+// What we have implemented here is head-based sampling.
+// See: https://github.com/komuw/otero/issues/11 (and the links therein)
+func DefaultSampler() trace.Sampler {
+	return trace.ParentBased(trace.TraceIDRatioBased(0.3))
+}
+
+func setupTracing(ctx context.Context, c Config, res *resource.Resource, certs *certSource) (*trace.TracerProvider, error) {
+	/*
+		Alternative ways of providing an exporter:
+		see: https://github.com/open-telemetry/opentelemetry-go/tree/v1.2.0/exporters
+
+		(a)
+		import "go.opentelemetry.io/otel/exporters/jaeger"
+		exporter, err := jaeger.New(
+			jaeger.WithCollectorEndpoint(
+				jaeger.WithEndpoint("http://jaeger:14268/api/traces")),
+		)
+
+		(b)
+		import "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	*/
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.Endpoint)}
+	if certs == nil {
+		// TLSConfig.Insecure; only for local development.
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(certs.clientConfig())))
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := trace.NewTracerProvider(
+		trace.WithBatcher(exporter), // use batch in prod.
+		trace.WithResource(res),
+		trace.WithSpanProcessor(loggingSpanProcessor{}),
+		trace.WithSpanProcessor(log.SpanProcessor()),
+		trace.WithSampler(c.Sampler),
+	)
+
+	/*
+	   When the tracer provider is created, we need to set it as the global tracer provider:
+	   This ensures that if someone uses the global tracer like;
+	       ctx, span := otel.Tracer("my-telemetry-library").Start(r.Context(), "get_user_cart")
+	       defer span.End()
+	   Then, they will always use our provider-tracer.
+	*/
+	otel.SetTracerProvider(provider)
+
+	return provider, nil
+}
+
+// loggingSpanProcessor logs at end of a span.
+type loggingSpanProcessor struct{}
+
+func (c loggingSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	// TODO: (komuw) merge s.Attributes() +  s.Resource() + s.Events()[maybe]
+	// attrSet := attribute.NewSet(s.Attributes()...)
+	// log.Println("\n\n\t onEnd called.",
+	// 	"s.Name(): ", s.Name(),
+	// 	"TraceID: ", s.SpanContext().TraceID(),
+	// 	"SpanID: ", s.SpanContext().SpanID(),
+	// 	"duration: ", s.EndTime().Sub(s.StartTime()),
+	// 	"s.Attributes(): ", attrSet.Encoded(attribute.DefaultEncoder()),
+	// 	"s.Resource(): ", s.Resource(),
+	// 	// events is where errorStacktraces(if any) are recorded.
+	// 	"s.Events(): ", s.Events(),
+	// )
+}
+
+func (c loggingSpanProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {}
+func (c loggingSpanProcessor) ForceFlush(ctx context.Context) error                  { return nil }
+func (c loggingSpanProcessor) Shutdown(ctx context.Context) error                    { return nil }